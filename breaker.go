@@ -0,0 +1,164 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrCircuitOpen is returned by the operations that write to Redis while
+// the circuit breaker is open. See Options.CircuitBreaker.
+var ErrCircuitOpen = errors.New("cache: circuit breaker is open")
+
+// CircuitState is the state of the circuit breaker.
+type CircuitState int32
+
+const (
+	// CircuitClosed means that Redis is used normally.
+	CircuitClosed CircuitState = iota
+	// CircuitOpen means that Redis is skipped after consecutive failures.
+	CircuitOpen
+	// CircuitHalfOpen means that a single probe is sent to Redis to check
+	// whether it has recovered.
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// CircuitBreakerOptions configures the circuit breaker that stops sending
+// commands to Redis after consecutive network errors. While the breaker is
+// open, Get and Once only use the LocalCache, Once calls Item.Do directly,
+// and writes to Redis fail with ErrCircuitOpen. After OpenTimeout, a single
+// command is sent to Redis to probe it.
+type CircuitBreakerOptions struct {
+	// MaxFailures is the number of consecutive failures that open the breaker.
+	// Default is 5.
+	MaxFailures int
+
+	// OpenTimeout is how long the breaker stays open before probing Redis.
+	// Default is 5 seconds.
+	OpenTimeout time.Duration
+}
+
+func (opt *CircuitBreakerOptions) maxFailures() int {
+	if opt.MaxFailures > 0 {
+		return opt.MaxFailures
+	}
+	return 5
+}
+
+func (opt *CircuitBreakerOptions) openTimeout() time.Duration {
+	if opt.OpenTimeout > 0 {
+		return opt.OpenTimeout
+	}
+	return 5 * time.Second
+}
+
+type circuitBreaker struct {
+	opt *CircuitBreakerOptions
+
+	state    int32 // CircuitState
+	failures int32
+
+	mu sync.Mutex
+	// probeAt is when the next probe can be sent. It is also used to send
+	// another probe if the result of the previous one was never reported.
+	probeAt time.Time
+}
+
+func newCircuitBreaker(opt *CircuitBreakerOptions) *circuitBreaker {
+	return &circuitBreaker{opt: opt}
+}
+
+func (cb *circuitBreaker) State() CircuitState {
+	if cb == nil {
+		return CircuitClosed
+	}
+	return CircuitState(atomic.LoadInt32(&cb.state))
+}
+
+// allow reports whether a command can be sent to Redis. The result of
+// the command must be reported using done.
+func (cb *circuitBreaker) allow() bool {
+	if cb.State() == CircuitClosed {
+		return true
+	}
+
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	now := time.Now()
+	if now.Before(cb.probeAt) {
+		return false
+	}
+
+	atomic.StoreInt32(&cb.state, int32(CircuitHalfOpen))
+	cb.probeAt = now.Add(cb.opt.openTimeout())
+	return true
+}
+
+// done records the result of a command allowed by allow.
+func (cb *circuitBreaker) done(err error) {
+	if cb == nil {
+		return
+	}
+
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		// The caller gave up, which says nothing about Redis.
+	case isRedisFailure(err):
+		cb.failure()
+	default:
+		cb.success()
+	}
+}
+
+func (cb *circuitBreaker) success() {
+	if cb.State() == CircuitClosed && atomic.LoadInt32(&cb.failures) == 0 {
+		return
+	}
+
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	atomic.StoreInt32(&cb.failures, 0)
+	atomic.StoreInt32(&cb.state, int32(CircuitClosed))
+}
+
+func (cb *circuitBreaker) failure() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	failures := atomic.AddInt32(&cb.failures, 1)
+	if cb.State() == CircuitClosed && int(failures) < cb.opt.maxFailures() {
+		return
+	}
+
+	atomic.StoreInt32(&cb.state, int32(CircuitOpen))
+	cb.probeAt = time.Now().Add(cb.opt.openTimeout())
+}
+
+// isRedisFailure reports whether err means that Redis is unavailable.
+// Misses and error replies prove that Redis is up.
+func isRedisFailure(err error) bool {
+	if err == nil || err == redis.Nil {
+		return false
+	}
+	var replyErr redis.Error
+	return !errors.As(err, &replyErr)
+}
@@ -0,0 +1,140 @@
+package cache_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/go-redis/cache/v9"
+)
+
+type countingHook struct {
+	n int64
+}
+
+func (h *countingHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h *countingHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		atomic.AddInt64(&h.n, 1)
+		return next(ctx, cmd)
+	}
+}
+
+func (h *countingHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		atomic.AddInt64(&h.n, 1)
+		return next(ctx, cmds)
+	}
+}
+
+var _ = Describe("Circuit breaker", func() {
+	ctx := context.TODO()
+
+	const key = "mykey"
+
+	var down int32
+	var hook *countingHook
+	var rdb *redis.Client
+	var mycache *cache.Cache
+	var callCount int64
+
+	once := func() int64 {
+		var n int64
+		err := mycache.Once(&cache.Item{
+			Ctx:   ctx,
+			Key:   key,
+			Value: &n,
+			Do: func(*cache.Item) (interface{}, error) {
+				return atomic.AddInt64(&callCount, 1), nil
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		return n
+	}
+
+	BeforeEach(func() {
+		atomic.StoreInt32(&down, 1)
+		atomic.StoreInt64(&callCount, 0)
+
+		hook = new(countingHook)
+		rdb = redis.NewClient(&redis.Options{
+			Addr:       ":6379",
+			MaxRetries: -1,
+			Dialer: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				if atomic.LoadInt32(&down) == 1 {
+					return nil, errors.New("redis is down")
+				}
+				var d net.Dialer
+				return d.DialContext(ctx, network, addr)
+			},
+		})
+		rdb.AddHook(hook)
+
+		mycache = cache.New(&cache.Options{
+			Redis:        rdb,
+			StatsEnabled: true,
+			CircuitBreaker: &cache.CircuitBreakerOptions{
+				MaxFailures: 2,
+				OpenTimeout: 100 * time.Millisecond,
+			},
+		})
+	})
+
+	AfterEach(func() {
+		Expect(rdb.Close()).NotTo(HaveOccurred())
+	})
+
+	It("calls Do directly while Redis is down", func() {
+		Expect(mycache.Stats().Circuit).To(Equal(cache.CircuitClosed))
+
+		// The failed Get and Set open the breaker.
+		Expect(once()).To(Equal(int64(1)))
+		Expect(mycache.Stats().Circuit).To(Equal(cache.CircuitOpen))
+
+		n := atomic.LoadInt64(&hook.n)
+		Expect(once()).To(Equal(int64(2)))
+		Expect(atomic.LoadInt64(&hook.n)).To(Equal(n))
+
+		err := mycache.Set(&cache.Item{Ctx: ctx, Key: key, Value: "value"})
+		Expect(err).To(Equal(cache.ErrCircuitOpen))
+	})
+
+	It("closes after a successful probe", func() {
+		once()
+		Expect(mycache.Stats().Circuit).To(Equal(cache.CircuitOpen))
+
+		time.Sleep(200 * time.Millisecond)
+
+		// The failed probe opens the breaker again.
+		n := atomic.LoadInt64(&hook.n)
+		once()
+		Expect(atomic.LoadInt64(&hook.n)).To(Equal(n + 1))
+		Expect(mycache.Stats().Circuit).To(Equal(cache.CircuitOpen))
+
+		atomic.StoreInt32(&down, 0)
+		time.Sleep(200 * time.Millisecond)
+
+		once()
+		Expect(mycache.Stats().Circuit).To(Equal(cache.CircuitClosed))
+		Expect(mycache.Exists(ctx, key)).To(BeTrue())
+	})
+
+	It("does not count misses as failures", func() {
+		atomic.StoreInt32(&down, 0)
+		Expect(rdb.Del(ctx, key).Err()).NotTo(HaveOccurred())
+
+		for i := 0; i < 3; i++ {
+			Expect(mycache.Exists(ctx, key)).To(BeFalse())
+		}
+		Expect(mycache.Stats().Circuit).To(Equal(cache.CircuitClosed))
+	})
+})
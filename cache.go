@@ -3,30 +3,36 @@ package cache
 import (
 	"context"
 	"errors"
-	"fmt"
 	"log"
-	"sync/atomic"
+	"math"
+	"math/rand"
+	"sync"
 	"time"
 
-	"github.com/klauspost/compress/s2"
 	"github.com/redis/go-redis/v9"
-	"github.com/vmihailenco/msgpack/v5"
 	"golang.org/x/sync/singleflight"
 )
 
-const (
-	compressionThreshold = 64
-	timeLen              = 4
-)
+const compressionThreshold = 64
 
 const (
 	noCompression = 0x0
-	s2Compression = 0x1
+
+	// notFoundMarker is stored instead of the value when Do reports that
+	// the value does not exist. It is never used in MessagePack and is not
+	// valid UTF-8, so it can't be confused with a regular value.
+	notFoundMarker = 0xc1
 )
 
 var (
-	ErrCacheMiss          = errors.New("cache: key is missing")
+	ErrCacheMiss = errors.New("cache: key is missing")
+
+	// ErrNotFound is returned by Item.Do to report that the value does not
+	// exist. See Item.NegativeTTL.
+	ErrNotFound = errors.New("cache: value is not found")
+
 	errRedisLocalCacheNil = errors.New("cache: both Redis and LocalCache are nil")
+	errPayloadTooShort    = errors.New("cache: payload is too short")
 )
 
 type rediser interface {
@@ -35,7 +41,23 @@ type rediser interface {
 	SetNX(ctx context.Context, key string, value interface{}, ttl time.Duration) *redis.BoolCmd
 
 	Get(ctx context.Context, key string) *redis.StringCmd
+	GetEx(ctx context.Context, key string, expiration time.Duration) *redis.StringCmd
+	Expire(ctx context.Context, key string, expiration time.Duration) *redis.BoolCmd
 	Del(ctx context.Context, keys ...string) *redis.IntCmd
+	Incr(ctx context.Context, key string) *redis.IntCmd
+
+	Eval(ctx context.Context, script string, keys []string, args ...interface{}) *redis.Cmd
+	Pipeline() redis.Pipeliner
+
+	Publish(ctx context.Context, channel string, message interface{}) *redis.IntCmd
+	Subscribe(ctx context.Context, channels ...string) *redis.PubSub
+}
+
+// setter is implemented by both rediser and redis.Pipeliner.
+type setter interface {
+	Set(ctx context.Context, key string, value interface{}, ttl time.Duration) *redis.StatusCmd
+	SetXX(ctx context.Context, key string, value interface{}, ttl time.Duration) *redis.BoolCmd
+	SetNX(ctx context.Context, key string, value interface{}, ttl time.Duration) *redis.BoolCmd
 }
 
 type Item struct {
@@ -48,6 +70,11 @@ type Item struct {
 	// Default TTL is 1 hour.
 	TTL time.Duration
 
+	// LocalTTL limits how long the value lives in the LocalCache,
+	// which never keeps it longer than TTL.
+	// See LocalCacheWithTTL.
+	LocalTTL time.Duration
+
 	// Do returns value to be cached.
 	Do func(*Item) (interface{}, error)
 
@@ -59,6 +86,40 @@ type Item struct {
 
 	// SkipLocalCache skips local cache as if it is not set.
 	SkipLocalCache bool
+
+	// SlidingTTL makes Once extend the expiration of the value in Redis
+	// to SlidingTTL every time it reads the value from Redis, using GETEX,
+	// which requires Redis 6.2 or later. Reads served by the LocalCache do
+	// not extend the expiration, so SlidingTTL should be longer than
+	// the LocalCache TTL.
+	SlidingTTL time.Duration
+
+	// XFetchBeta enables probabilistic early recomputation in Once using
+	// the XFetch algorithm: shortly before the value expires, Once recomputes
+	// it with a probability that grows as the expiration approaches and with
+	// how long the previous Do took. Values greater than 1 favor earlier
+	// recomputation; 1 is a good default.
+	//
+	// Like StaleTTL, it only applies to values encoded by the default Marshal.
+	XFetchBeta float64
+
+	// StaleTTL enables stale-while-revalidate mode for Once. When the value
+	// is older than TTL but younger than TTL+StaleTTL, Once returns the stale
+	// value immediately and refreshes it in background using Do.
+	//
+	// The write time is only recorded for values encoded by the default
+	// Marshal, so strings and byte slices are never considered stale.
+	StaleTTL time.Duration
+
+	// Tags are used to invalidate groups of keys with Cache.InvalidateTags.
+	// Requires Redis 7.0 or later and, if the cache has a LocalCache,
+	// Options.InvalidationChannel or Options.Tracking in all processes.
+	Tags []string
+
+	// NegativeTTL enables negative caching. When Do returns ErrNotFound,
+	// the absence of the value is cached for NegativeTTL, and Get and Once
+	// return ErrNotFound without calling Do until it expires.
+	NegativeTTL time.Duration
 }
 
 func (item *Item) Context() context.Context {
@@ -96,35 +157,146 @@ func (item *Item) ttl() time.Duration {
 	return defaultTTL
 }
 
+// redisTTL returns the expiration time of the key in Redis, which includes
+// the period when the value is served stale.
+func (item *Item) redisTTL() time.Duration {
+	ttl := item.ttl()
+	if ttl > 0 && item.StaleTTL > 0 {
+		ttl += item.StaleTTL
+	}
+	return ttl
+}
+
+// localTTL returns the expiration time of the value in the LocalCache.
+// Zero means the LocalCache default.
+func (item *Item) localTTL() time.Duration {
+	ttl := item.redisTTL()
+	if item.LocalTTL > 0 && (ttl == 0 || item.LocalTTL < ttl) {
+		ttl = item.LocalTTL
+	}
+	return ttl
+}
+
 //------------------------------------------------------------------------------
+
 type (
 	MarshalFunc   func(interface{}) ([]byte, error)
 	UnmarshalFunc func([]byte, interface{}) error
 )
 
 type Options struct {
+	// Name identifies the cache in metrics when several caches are used.
+	Name string
+
 	Redis        rediser
 	LocalCache   LocalCache
 	StatsEnabled bool
 	Marshal      MarshalFunc
 	Unmarshal    UnmarshalFunc
+
+	// Prefix is prepended to all keys stored in Redis and the LocalCache.
+	// See also Cache.WithNamespace.
+	Prefix string
+
+	// StatsKeyFunc classifies keys into groups reported by StatsByGroup,
+	// e.g. by returning the part of the key before the first ':'.
+	// The keys don't include Prefix and the namespace.
+	// It requires StatsEnabled. At most 100 groups are tracked;
+	// the keys of the other groups are reported in StatsOtherGroup.
+	StatsKeyFunc func(key string) string
+
+	// Codec is used to encode values unless Marshal and Unmarshal are set.
+	// The default is MsgpackCodec.
+	Codec Codec
+	// Compressor compresses the encoded values that are larger than
+	// CompressionThreshold. The default is S2Compressor; NoCompressor
+	// disables compression. Values compressed by the built-in compressors
+	// and Decompressors can always be read, so the compressor can be
+	// changed without invalidating the cache.
+	Compressor Compressor
+	// CompressionThreshold is the minimal size of an encoded value
+	// to be compressed. The default is 64 bytes; -1 disables compression.
+	CompressionThreshold int
+	// Decompressors are the custom compressors that are only used to read
+	// the values, e.g. when migrating to a different Compressor.
+	Decompressors []Compressor
+
+	// Lock enables a distributed lock in Once, so only one process
+	// recomputes a missing key. Requires Redis.
+	Lock *LockOptions
+
+	// InvalidationChannel enables the invalidation bus: deleted and
+	// overwritten keys are published on this Redis channel and evicted
+	// from the LocalCache of all Cache instances subscribed to it.
+	// The LocalCache should implement LocalCacheWithReset, so it can be
+	// reset when the subscription drops. Call Cache.Close to stop
+	// the subscription.
+	InvalidationChannel string
+
+	// Tracking enables server-assisted client-side caching: Redis notifies
+	// the cache when keys stored in the LocalCache are modified.
+	// Requires LocalCache, which should implement LocalCacheWithReset
+	// like InvalidationChannel. Call Cache.Close to stop tracking.
+	Tracking *TrackingOptions
+
+	// CircuitBreaker stops sending commands to Redis after consecutive
+	// network errors, so a Redis outage does not slow down every call.
+	CircuitBreaker *CircuitBreakerOptions
 }
 
 type Cache struct {
+	*core
+
+	// ns is the namespace of the view returned by WithNamespace.
+	ns *namespace
+}
+
+// core is the state shared by a Cache and its namespace views.
+type core struct {
+	// stats must stay the first field, so its counters are 64-bit aligned
+	// for the atomic operations on 32-bit platforms.
+	stats stats
+	// invalidations is incremented when keys are evicted from the LocalCache
+	// by tracking or the invalidation bus.
+	invalidations uint64
+
 	opt *Options
 
-	group singleflight.Group
+	group        singleflight.Group
+	refreshGroup singleflight.Group
+
+	onceManyMu    sync.Mutex
+	onceManyCalls map[string]*onceManyCall
 
 	marshal   MarshalFunc
 	unmarshal UnmarshalFunc
 
-	hits   uint64
-	misses uint64
+	codec                Codec
+	compressor           Compressor
+	compressionThreshold int
+	codecs               *codecSet
+	compressors          *compressorSet
+
+	invalidator *invalidator
+	tracker     *tracker
+	breaker     *circuitBreaker
+
+	hooks []Hook
+
+	groupsMu sync.RWMutex
+	groups   map[string]*groupStats
+
+	namespacesMu sync.Mutex
+	namespaces   map[string]*namespace
+
+	refresherMu sync.Mutex
+	refresher   *refresher
+	closed      bool
 }
 
 func New(opt *Options) *Cache {
 	cacher := &Cache{
-		opt: opt,
+		core: &core{opt: opt},
 	}
 
 	if opt.Marshal == nil {
@@ -138,54 +310,287 @@ func New(opt *Options) *Cache {
 	} else {
 		cacher.unmarshal = opt.Unmarshal
 	}
+
+	cacher.codec = opt.Codec
+	if cacher.codec == nil {
+		cacher.codec = MsgpackCodec
+	}
+	cacher.compressor = opt.Compressor
+	if cacher.compressor == nil {
+		cacher.compressor = S2Compressor
+	}
+	cacher.compressionThreshold = opt.CompressionThreshold
+	if cacher.compressor.ID() == noCompression {
+		cacher.compressionThreshold = -1
+	} else if cacher.compressionThreshold == 0 {
+		cacher.compressionThreshold = compressionThreshold
+	}
+	cacher.codecs = newCodecSet(opt)
+	cacher.compressors = newCompressorSet(opt)
+
+	if opt.InvalidationChannel != "" || opt.Tracking != nil {
+		if _, ok := opt.LocalCache.(LocalCacheWithReset); opt.LocalCache != nil && !ok {
+			log.Printf("cache: %T does not implement LocalCacheWithReset, "+
+				"so it is not reset when invalidations are missed", opt.LocalCache)
+		}
+	}
+	if opt.InvalidationChannel != "" && opt.Redis != nil {
+		cacher.invalidator = newInvalidator(cacher)
+	}
+	if opt.CircuitBreaker != nil && opt.Redis != nil {
+		cacher.breaker = newCircuitBreaker(opt.CircuitBreaker)
+	}
+	if opt.Tracking != nil && opt.LocalCache != nil {
+		cacher.tracker = newTracker(cacher, opt.Tracking)
+	}
 	return cacher
 }
 
+// Close releases the resources used by the cache, e.g. stops
+// the invalidation bus subscription, tracking and the refreshes of
+// the registered keys.
+func (cd *Cache) Close() error {
+	cd.refresherMu.Lock()
+	r := cd.refresher
+	cd.closed = true
+	cd.refresherMu.Unlock()
+	if r != nil {
+		r.close()
+	}
+
+	var firstErr error
+	if cd.invalidator != nil {
+		firstErr = cd.invalidator.close()
+	}
+	if cd.tracker != nil {
+		if err := cd.tracker.close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
 // Set caches the item.
 func (cd *Cache) Set(item *Item) error {
-	_, _, err := cd.set(item)
-	return err
+	item = cd.itemWithKey(item)
+	event := &Event{Op: OpSet, Key: item.Key}
+	return cd.withItemHooks(item, event, func(item *Item) error {
+		b, _, err := cd.set(item)
+		event.Size = len(b)
+		return err
+	})
 }
 
 func (cd *Cache) set(item *Item) ([]byte, bool, error) {
-	value, err := item.value()
+	b, err := cd.itemBytes(item)
 	if err != nil {
+		if item.NegativeTTL > 0 && errors.Is(err, ErrNotFound) {
+			cd.setNotFound(item)
+		}
 		return nil, false, err
 	}
 
-	b, err := cd.Marshal(value)
+	_, err = cd.write(item, b)
+	return b, true, err
+}
+
+// write stores the encoded item in the LocalCache and Redis and reports
+// whether the write was applied. With Item.SetNX and Item.SetXX the
+// LocalCache is only updated when Redis accepts the write.
+func (cd *Cache) write(item *Item, b []byte) (bool, error) {
+	if err := cd.checkTags(item.Tags); err != nil {
+		return false, err
+	}
+
+	conditional := item.SetNX || item.SetXX
+	useLocal := cd.opt.LocalCache != nil && !item.SkipLocalCache
+	ttl := item.redisTTL()
+
+	if cd.opt.Redis == nil || ttl == 0 {
+		if cd.opt.Redis == nil && cd.opt.LocalCache == nil {
+			return false, errRedisLocalCacheNil
+		}
+		if !useLocal {
+			return !conditional, nil
+		}
+		return cd.setLocalIf(item, b), nil
+	}
+
+	if useLocal && !conditional {
+		cd.setLocal(item.Key, b, item.localTTL())
+	}
+
+	if !cd.breaker.allow() {
+		return false, ErrCircuitOpen
+	}
+
+	var cmd redis.Cmder
+	var err error
+	if len(item.Tags) == 0 && cd.invalidator == nil {
+		cmd = setItem(cd.opt.Redis, item, b, ttl)
+		err = cmd.Err()
+	} else {
+		pipe := cd.opt.Redis.Pipeline()
+		cmd = setItem(pipe, item, b, ttl)
+		cd.addTags(pipe, item, ttl)
+		cd.publish(item.Context(), pipe, item.Key)
+		_, err = pipe.Exec(item.Context())
+	}
+	cd.redisDone(err)
 	if err != nil {
-		return nil, false, err
+		return false, err
 	}
 
-	if cd.opt.LocalCache != nil && !item.SkipLocalCache {
-		cd.opt.LocalCache.Set(item.Key, b)
+	// SET NX and SET XX report whether the key was set.
+	if cmd, ok := cmd.(*redis.BoolCmd); ok && !cmd.Val() {
+		return false, nil
 	}
 
-	if cd.opt.Redis == nil {
-		if cd.opt.LocalCache == nil {
-			return b, true, errRedisLocalCacheNil
+	cd.incr(&cd.stats.bytesWritten, uint64(len(b)))
+	if useLocal && conditional {
+		cd.setLocal(item.Key, b, item.localTTL())
+	}
+	return true, nil
+}
+
+// setLocalIf stores the item in the LocalCache unless Item.SetNX or
+// Item.SetXX prevent it and reports whether the item was stored.
+func (cd *Cache) setLocalIf(item *Item, b []byte) bool {
+	if item.SetNX || item.SetXX {
+		if _, exists := cd.opt.LocalCache.Get(item.Key); exists != item.SetXX {
+			return false
 		}
-		return b, true, nil
 	}
+	cd.setLocal(item.Key, b, item.localTTL())
+	return true
+}
 
-	ttl := item.ttl()
-	if ttl == 0 {
-		return b, true, nil
+// SetIfAbsent caches the item only if the key does not exist, like Set with
+// Item.SetNX, and reports whether the item was written.
+func (cd *Cache) SetIfAbsent(item *Item) (bool, error) {
+	return cd.setIf(item, true)
+}
+
+// SetIfPresent caches the item only if the key already exists, like Set
+// with Item.SetXX, and reports whether the item was written.
+func (cd *Cache) SetIfPresent(item *Item) (bool, error) {
+	return cd.setIf(item, false)
+}
+
+func (cd *Cache) setIf(item *Item, absent bool) (bool, error) {
+	item = cd.itemWithKey(item)
+	item.SetNX, item.SetXX = absent, !absent
+
+	var applied bool
+	event := &Event{Op: OpSet, Key: item.Key}
+	err := cd.withItemHooks(item, event, func(item *Item) error {
+		b, err := cd.itemBytes(item)
+		if err != nil {
+			return err
+		}
+		applied, err = cd.write(item, b)
+		if applied {
+			event.Size = len(b)
+		}
+		return err
+	})
+	return applied, err
+}
+
+func (cd *Cache) setNotFound(item *Item) {
+	b := []byte{notFoundMarker}
+
+	if cd.opt.LocalCache != nil && !item.SkipLocalCache {
+		ttl := item.NegativeTTL
+		if item.LocalTTL > 0 && item.LocalTTL < ttl {
+			ttl = item.LocalTTL
+		}
+		cd.setLocal(item.Key, b, ttl)
+	}
+	if cd.opt.Redis != nil && cd.breaker.allow() {
+		pipe := cd.opt.Redis.Pipeline()
+		pipe.Set(item.Context(), item.Key, b, item.NegativeTTL)
+		cd.publish(item.Context(), pipe, item.Key)
+		_, err := pipe.Exec(item.Context())
+		cd.redisDone(err)
+		if err == nil {
+			cd.incr(&cd.stats.bytesWritten, uint64(len(b)))
+		}
+	}
+}
+
+func isNotFound(b []byte) bool {
+	return len(b) == 1 && b[0] == notFoundMarker
+}
+
+func (cd *Cache) itemBytes(item *Item) ([]byte, error) {
+	start := time.Now()
+	value, err := cd.itemValue(item)
+	if err != nil {
+		return nil, err
+	}
+
+	if cd.opt.Marshal != nil || item.XFetchBeta <= 0 {
+		return cd.Marshal(value)
+	}
+
+	now := time.Now()
+	return cd.encode(value, &Metadata{
+		CreatedAt: now,
+		Delta:     now.Sub(start),
+		ExpireAt:  now.Add(item.ttl()),
+	})
+}
+
+// itemValue returns the item value calling Item.Do between the hooks.
+func (cd *Cache) itemValue(item *Item) (interface{}, error) {
+	if item.Do == nil {
+		return item.value()
 	}
 
+	cd.incr(&cd.stats.loaderCalls, 1)
+
+	var value interface{}
+	var err error
+	if len(cd.hooks) == 0 {
+		value, err = item.value()
+	} else {
+		event := &Event{Op: OpDo, Key: item.Key, Tier: TierLoader}
+		err = cd.withItemHooks(item, event, func(item *Item) error {
+			var err error
+			value, err = item.value()
+			return err
+		})
+	}
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		cd.incr(&cd.stats.loaderErrors, 1)
+	}
+	return value, err
+}
+
+func setItem(c setter, item *Item, b []byte, ttl time.Duration) redis.Cmder {
 	if item.SetXX {
-		return b, true, cd.opt.Redis.SetXX(item.Context(), item.Key, b, ttl).Err()
+		return c.SetXX(item.Context(), item.Key, b, ttl)
 	}
 	if item.SetNX {
-		return b, true, cd.opt.Redis.SetNX(item.Context(), item.Key, b, ttl).Err()
+		return c.SetNX(item.Context(), item.Key, b, ttl)
 	}
-	return b, true, cd.opt.Redis.Set(item.Context(), item.Key, b, ttl).Err()
+	return c.Set(item.Context(), item.Key, b, ttl)
 }
 
 // Exists reports whether value for the given key exists.
 func (cd *Cache) Exists(ctx context.Context, key string) bool {
-	_, err := cd.getBytes(ctx, key, false)
+	event := &Event{Op: OpGet, Key: cd.key(ctx, key)}
+	err := cd.withGroupStats(key, event, func() error {
+		return cd.withHooks(ctx, event, func(ctx context.Context) error {
+			b, tier, err := cd.getBytesFrom(ctx, event.Key, false)
+			event.Tier, event.Size = tier, len(b)
+			if err == nil && isNotFound(b) {
+				return ErrNotFound
+			}
+			return err
+		})
+	})
 	return err == nil
 }
 
@@ -207,47 +612,98 @@ func (cd *Cache) get(
 	value interface{},
 	skipLocalCache bool,
 ) error {
-	b, err := cd.getBytes(ctx, key, skipLocalCache)
-	if err != nil {
-		return err
-	}
-	return cd.unmarshal(b, value)
+	event := &Event{Op: OpGet, Key: cd.key(ctx, key)}
+	return cd.withGroupStats(key, event, func() error {
+		return cd.withHooks(ctx, event, func(ctx context.Context) error {
+			b, tier, err := cd.getBytesFrom(ctx, event.Key, skipLocalCache)
+			event.Tier, event.Size = tier, len(b)
+			if err != nil {
+				return err
+			}
+			if isNotFound(b) {
+				return ErrNotFound
+			}
+			return cd.unmarshalValue(b, value)
+		})
+	})
 }
 
 func (cd *Cache) getBytes(ctx context.Context, key string, skipLocalCache bool) ([]byte, error) {
-	if !skipLocalCache && cd.opt.LocalCache != nil {
-		b, ok := cd.opt.LocalCache.Get(key)
-		if ok {
-			return b, nil
+	b, _, err := cd.getBytesFrom(ctx, key, skipLocalCache)
+	return b, err
+}
+
+// getBytesFrom is like getBytes, but also returns the tier that served
+// the value.
+func (cd *Cache) getBytesFrom(
+	ctx context.Context, key string, skipLocalCache bool,
+) ([]byte, Tier, error) {
+	if !skipLocalCache {
+		if b, ok := cd.getLocal(key); ok {
+			return b, TierLocal, nil
 		}
 	}
+	return cd.getRedisBytes(ctx, key, skipLocalCache, 0, 0)
+}
+
+// getLocal gets the value from the LocalCache counting hits and misses.
+func (cd *Cache) getLocal(key string) ([]byte, bool) {
+	if cd.opt.LocalCache == nil {
+		return nil, false
+	}
+	b, ok := cd.opt.LocalCache.Get(key)
+	if ok {
+		cd.incr(&cd.stats.localHits, 1)
+	} else {
+		cd.incr(&cd.stats.localMisses, 1)
+	}
+	return b, ok
+}
 
+// getRedisBytes gets the value from Redis and stores it in the LocalCache
+// for localTTL, or the LocalCache default if it is zero. If slidingTTL is
+// positive, the expiration of the key is extended to slidingTTL.
+func (cd *Cache) getRedisBytes(
+	ctx context.Context, key string, skipLocalCache bool, slidingTTL, localTTL time.Duration,
+) ([]byte, Tier, error) {
 	if cd.opt.Redis == nil {
 		if cd.opt.LocalCache == nil {
-			return nil, errRedisLocalCacheNil
+			return nil, TierNone, errRedisLocalCacheNil
 		}
-		return nil, ErrCacheMiss
+		return nil, TierNone, ErrCacheMiss
+	}
+
+	if !cd.breaker.allow() {
+		cd.incr(&cd.stats.misses, 1)
+		return nil, TierNone, ErrCacheMiss
 	}
 
-	b, err := cd.opt.Redis.Get(ctx, key).Bytes()
+	epoch := cd.localEpoch()
+	rdb, cacheLocally := cd.tracker.reader(cd.opt.Redis)
+	var cmd *redis.StringCmd
+	if slidingTTL > 0 {
+		cmd = rdb.GetEx(ctx, key, slidingTTL)
+	} else {
+		cmd = rdb.Get(ctx, key)
+	}
+	b, err := cmd.Bytes()
+	cd.redisDone(err)
 	if err != nil {
-		if cd.opt.StatsEnabled {
-			atomic.AddUint64(&cd.misses, 1)
-		}
+		cd.incr(&cd.stats.misses, 1)
 		if err == redis.Nil {
-			return nil, ErrCacheMiss
+			cd.incr(&cd.stats.redisMisses, 1)
+			return nil, TierNone, ErrCacheMiss
 		}
-		return nil, err
+		return nil, TierNone, err
 	}
 
-	if cd.opt.StatsEnabled {
-		atomic.AddUint64(&cd.hits, 1)
-	}
+	cd.incr(&cd.stats.redisHits, 1)
+	cd.incr(&cd.stats.bytesRead, uint64(len(b)))
 
-	if !skipLocalCache && cd.opt.LocalCache != nil {
-		cd.opt.LocalCache.Set(key, b)
+	if !skipLocalCache && cd.opt.LocalCache != nil && cacheLocally {
+		cd.setLocalRead(key, b, localTTL, epoch)
 	}
-	return b, nil
+	return b, TierRedis, nil
 }
 
 // Once gets the item.Value for the given item.Key from the cache or
@@ -256,19 +712,51 @@ func (cd *Cache) getBytes(ctx context.Context, key string, skipLocalCache bool)
 // at a time. If a duplicate comes in, the duplicate caller waits for the
 // original to complete and receives the same results.
 func (cd *Cache) Once(item *Item) error {
-	b, cached, err := cd.getSetItemBytesOnce(item)
+	return cd.onceItem(cd.itemWithKey(item), item.Key)
+}
+
+// onceItem is like Once, but the item key already includes the prefix.
+// The key passed to Once is used for the stats of the key group.
+func (cd *Cache) onceItem(item *Item, key string) error {
+	event := &Event{Op: OpOnce, Key: item.Key}
+	return cd.withGroupStats(key, event, func() error {
+		return cd.withItemHooks(item, event, func(item *Item) error {
+			return cd.once(item, key, event)
+		})
+	})
+}
+
+func (cd *Cache) once(item *Item, key string, event *Event) error {
+	b, tier, err := cd.getSetItemBytesOnce(item)
+	event.Tier, event.Size = tier, len(b)
 	if err != nil {
 		return err
 	}
+	cached := tier != TierLoader
+
+	if isNotFound(b) {
+		return ErrNotFound
+	}
+
+	if cached && item.XFetchBeta > 0 && item.Do != nil && shouldRecompute(item, b) {
+		if fresh, err := cd.recompute(item); err == nil {
+			b, cached = fresh, false
+			event.Tier, event.Size = TierLoader, len(b)
+		}
+	}
+
+	if cached && item.StaleTTL > 0 && item.Do != nil && isStale(item, b) {
+		cd.refresh(item)
+	}
 
 	if item.Value == nil || len(b) == 0 {
 		return nil
 	}
 
-	if err := cd.unmarshal(b, item.Value); err != nil {
+	if err := cd.unmarshalValue(b, item.Value); err != nil {
 		if cached {
-			_ = cd.Delete(item.Context(), item.Key)
-			return cd.Once(item)
+			_ = cd.deleteKey(item.Context(), item.Key)
+			return cd.onceItem(item, key)
 		}
 		return err
 	}
@@ -276,20 +764,35 @@ func (cd *Cache) Once(item *Item) error {
 	return nil
 }
 
-func (cd *Cache) getSetItemBytesOnce(item *Item) (b []byte, cached bool, err error) {
-	if cd.opt.LocalCache != nil {
-		b, ok := cd.opt.LocalCache.Get(item.Key)
-		if ok {
-			return b, true, nil
-		}
+func (cd *Cache) getSetItemBytesOnce(item *Item) (b []byte, tier Tier, err error) {
+	if b, ok := cd.getLocal(item.Key); ok {
+		return b, TierLocal, nil
 	}
 
-	v, err, _ := cd.group.Do(item.Key, func() (interface{}, error) {
-		b, err := cd.getBytes(item.Context(), item.Key, item.SkipLocalCache)
+	// Duplicate callers get the value computed by the original one.
+	tier = TierLoader
+	var leader bool
+
+	v, err, shared := cd.group.Do(item.Key, func() (interface{}, error) {
+		leader = true
+
+		var b []byte
+		var err error
+		b, tier, err = cd.getRedisBytes(
+			item.Context(), item.Key, item.SkipLocalCache, item.SlidingTTL, item.localTTL())
 		if err == nil {
-			cached = true
 			return b, nil
 		}
+		tier = TierLoader
+
+		if cd.opt.Lock != nil && cd.opt.Redis != nil && cd.breaker.State() == CircuitClosed {
+			var cached bool
+			b, cached, err = cd.setLocked(item)
+			if cached {
+				tier = TierRedis
+			}
+			return b, err
+		}
 
 		b, ok, err := cd.set(item)
 		if ok {
@@ -297,13 +800,83 @@ func (cd *Cache) getSetItemBytesOnce(item *Item) (b []byte, cached bool, err err
 		}
 		return nil, err
 	})
+	if shared && !leader {
+		cd.incr(&cd.stats.singleflightDedups, 1)
+	}
 	if err != nil {
-		return nil, false, err
+		return nil, TierNone, err
+	}
+	return v.([]byte), tier, nil
+}
+
+// shouldRecompute implements XFetch: it returns true with a probability that
+// grows as the value approaches its expiration time. Like isStale, it only
+// trusts the metadata of values with the envelope header.
+func shouldRecompute(item *Item, b []byte) bool {
+	_, meta, err := parsePayload(b)
+	if err != nil || meta.Version != envelopeVersion || meta.ExpireAt.IsZero() {
+		return false
+	}
+
+	// 1-rand.Float64() is in (0, 1], so the logarithm is finite and <= 0.
+	gap := -float64(meta.Delta) * item.XFetchBeta * math.Log(1-rand.Float64())
+	return !time.Now().Add(time.Duration(gap)).Before(meta.ExpireAt)
+}
+
+// recompute recomputes and caches the item that is about to expire.
+// Once ignores the error, because the cached value can still be used.
+func (cd *Cache) recompute(item *Item) ([]byte, error) {
+	v, err, _ := cd.group.Do(item.Key, func() (interface{}, error) {
+		b, ok, err := cd.set(item)
+		if ok {
+			return b, nil
+		}
+		return nil, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.([]byte), nil
+}
+
+// isStale reports whether the value is older than the item TTL. Only values
+// with the envelope header record the write time reliably: the trailer of
+// strings and byte slices is a part of the value.
+func isStale(item *Item, b []byte) bool {
+	_, meta, err := parsePayload(b)
+	if err != nil || meta.Version != envelopeVersion {
+		return false
 	}
-	return v.([]byte), cached, nil
+	return !meta.CreatedAt.IsZero() && time.Since(meta.CreatedAt) > item.ttl()
+}
+
+// refresh updates the stale item in background making sure that only one
+// refresh is in-flight for a given item.Key at a time.
+func (cd *Cache) refresh(item *Item) {
+	refreshed := *item
+	refreshed.Ctx = detachedContext{parent: item.Context()}
+	refreshed.Value = nil
+
+	_ = cd.refreshGroup.DoChan(item.Key, func() (interface{}, error) {
+		_, _, err := cd.set(&refreshed)
+		if err != nil && err != errRedisLocalCacheNil {
+			log.Printf("cache: refreshing stale key=%q failed: %s", item.Key, err)
+		}
+		return nil, err
+	})
 }
 
 func (cd *Cache) Delete(ctx context.Context, key string) error {
+	return cd.deleteKey(ctx, cd.key(ctx, key))
+}
+
+func (cd *Cache) deleteKey(ctx context.Context, key string) error {
+	return cd.withHooks(ctx, &Event{Op: OpDelete, Key: key}, func(ctx context.Context) error {
+		return cd.delete(ctx, key)
+	})
+}
+
+func (cd *Cache) delete(ctx context.Context, key string) error {
 	if cd.opt.LocalCache != nil {
 		cd.opt.LocalCache.Del(key)
 	}
@@ -315,13 +888,26 @@ func (cd *Cache) Delete(ctx context.Context, key string) error {
 		return nil
 	}
 
-	_, err := cd.opt.Redis.Del(ctx, key).Result()
+	if !cd.breaker.allow() {
+		return ErrCircuitOpen
+	}
+
+	var err error
+	if cd.invalidator == nil {
+		_, err = cd.opt.Redis.Del(ctx, key).Result()
+	} else {
+		pipe := cd.opt.Redis.Pipeline()
+		pipe.Del(ctx, key)
+		cd.publish(ctx, pipe, key)
+		_, err = pipe.Exec(ctx)
+	}
+	cd.redisDone(err)
 	return err
 }
 
 func (cd *Cache) DeleteFromLocalCache(key string) {
 	if cd.opt.LocalCache != nil {
-		cd.opt.LocalCache.Del(key)
+		cd.opt.LocalCache.Del(cd.key(context.Background(), key))
 	}
 }
 
@@ -330,37 +916,7 @@ func (cd *Cache) Marshal(value interface{}) ([]byte, error) {
 }
 
 func (cd *Cache) _marshal(value interface{}) ([]byte, error) {
-	switch value := value.(type) {
-	case nil:
-		return nil, nil
-	case []byte:
-		return value, nil
-	case string:
-		return []byte(value), nil
-	}
-
-	b, err := msgpack.Marshal(value)
-	if err != nil {
-		return nil, err
-	}
-
-	return compress(b), nil
-}
-
-func compress(data []byte) []byte {
-	if len(data) < compressionThreshold {
-		n := len(data) + 1
-		b := make([]byte, n, n+timeLen)
-		copy(b, data)
-		b[len(b)-1] = noCompression
-		return b
-	}
-
-	n := s2.MaxEncodedLen(len(data)) + 1
-	b := make([]byte, n, n+timeLen)
-	b = s2.Encode(b, data)
-	b = append(b, s2Compression)
-	return b
+	return cd.encode(value, new(Metadata))
 }
 
 func (cd *Cache) Unmarshal(b []byte, value interface{}) error {
@@ -371,6 +927,9 @@ func (cd *Cache) _unmarshal(b []byte, value interface{}) error {
 	if len(b) == 0 {
 		return nil
 	}
+	if isNotFound(b) {
+		return ErrNotFound
+	}
 
 	switch value := value.(type) {
 	case nil:
@@ -385,38 +944,36 @@ func (cd *Cache) _unmarshal(b []byte, value interface{}) error {
 		return nil
 	}
 
-	switch c := b[len(b)-1]; c {
-	case noCompression:
-		b = b[:len(b)-1]
-	case s2Compression:
-		b = b[:len(b)-1]
+	b, meta, err := parsePayload(b)
+	if err != nil {
+		return err
+	}
+
+	codec, err := cd.codecs.get(meta.Codec)
+	if err != nil {
+		return err
+	}
 
-		var err error
-		b, err = s2.Decode(nil, b)
-		if err != nil {
-			return err
-		}
-	default:
-		return fmt.Errorf("unknown compression method: %x", c)
+	b, err = cd.compressors.decompress(meta.Compressor, b)
+	if err != nil {
+		return err
 	}
 
-	return msgpack.Unmarshal(b, value)
+	return codec.Unmarshal(b, value)
 }
 
 //------------------------------------------------------------------------------
 
-type Stats struct {
-	Hits   uint64
-	Misses uint64
+// detachedContext keeps the values of the parent context, but is never
+// canceled, so it can be used for work that outlives the request.
+type detachedContext struct {
+	parent context.Context
 }
 
-// Stats returns cache statistics.
-func (cd *Cache) Stats() *Stats {
-	if !cd.opt.StatsEnabled {
-		return nil
-	}
-	return &Stats{
-		Hits:   atomic.LoadUint64(&cd.hits),
-		Misses: atomic.LoadUint64(&cd.misses),
-	}
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+func (c detachedContext) Value(key interface{}) interface{} {
+	return c.parent.Value(key)
 }
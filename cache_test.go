@@ -3,6 +3,7 @@ package cache_test
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"sync"
 	"sync/atomic"
@@ -79,6 +80,53 @@ var _ = Describe("Cache", func() {
 			Expect(mycache.Exists(ctx, key)).To(BeFalse())
 		})
 
+		It("expires local value after LocalTTL", func() {
+			err := mycache.Set(&cache.Item{
+				Ctx:      ctx,
+				Key:      key,
+				Value:    obj,
+				TTL:      time.Hour,
+				LocalTTL: 100 * time.Millisecond,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			time.Sleep(200 * time.Millisecond)
+
+			wanted := new(Object)
+			err = mycache.Get(ctx, key, wanted)
+			if rdb == nil {
+				Expect(err).To(Equal(cache.ErrCacheMiss))
+			} else {
+				Expect(err).NotTo(HaveOccurred())
+				Expect(wanted).To(Equal(obj))
+			}
+		})
+
+		It("expires values read from Redis after LocalTTL", func() {
+			if rdb == nil {
+				return
+			}
+
+			err := newCache(rdb).Set(&cache.Item{Ctx: ctx, Key: key, Value: obj, TTL: time.Hour})
+			Expect(err).NotTo(HaveOccurred())
+
+			err = mycache.Once(&cache.Item{
+				Ctx:      ctx,
+				Key:      key,
+				Value:    new(Object),
+				TTL:      time.Hour,
+				LocalTTL: 100 * time.Millisecond,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			err = rdb.Del(ctx, key).Err()
+			Expect(err).NotTo(HaveOccurred())
+			time.Sleep(200 * time.Millisecond)
+
+			err = mycache.Get(ctx, key, new(Object))
+			Expect(err).To(Equal(cache.ErrCacheMiss))
+		})
+
 		It("Gets and Sets data", func() {
 			err := mycache.Set(&cache.Item{
 				Ctx:   ctx,
@@ -128,6 +176,87 @@ var _ = Describe("Cache", func() {
 			Expect(dst).To(Equal(value))
 		})
 
+		It("reports whether SetIfAbsent and SetIfPresent wrote the value", func() {
+			ok, err := mycache.SetIfPresent(&cache.Item{Ctx: ctx, Key: key, Value: "first"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeFalse())
+			Expect(mycache.Exists(ctx, key)).To(BeFalse())
+
+			ok, err = mycache.SetIfAbsent(&cache.Item{Ctx: ctx, Key: key, Value: "first"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeTrue())
+
+			ok, err = mycache.SetIfAbsent(&cache.Item{Ctx: ctx, Key: key, Value: "second"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeFalse())
+
+			var s string
+			Expect(mycache.Get(ctx, key, &s)).NotTo(HaveOccurred())
+			Expect(s).To(Equal("first"))
+
+			ok, err = mycache.SetIfPresent(&cache.Item{Ctx: ctx, Key: key, Value: "third"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeTrue())
+
+			Expect(mycache.Get(ctx, key, &s)).NotTo(HaveOccurred())
+			Expect(s).To(Equal("third"))
+		})
+
+		It("does not modify the item in SetIfAbsent", func() {
+			item := &cache.Item{Ctx: ctx, Key: key, Value: "value"}
+
+			var wg sync.WaitGroup
+			for i := 0; i < 4; i++ {
+				wg.Add(2)
+				go func() {
+					defer GinkgoRecover()
+					defer wg.Done()
+
+					_, err := mycache.SetIfAbsent(item)
+					Expect(err).NotTo(HaveOccurred())
+				}()
+				go func() {
+					defer GinkgoRecover()
+					defer wg.Done()
+
+					Expect(mycache.Set(item)).NotTo(HaveOccurred())
+				}()
+			}
+			wg.Wait()
+
+			Expect(item.SetNX).To(BeFalse())
+			Expect(item.SetXX).To(BeFalse())
+		})
+
+		It("does not update LocalCache when SetNX fails", func() {
+			if rdb == nil {
+				return
+			}
+
+			err := rdb.Set(ctx, key, "redis", time.Hour).Err()
+			Expect(err).NotTo(HaveOccurred())
+
+			err = mycache.Set(&cache.Item{Ctx: ctx, Key: key, Value: "local", SetNX: true})
+			Expect(err).NotTo(HaveOccurred())
+
+			var s string
+			Expect(mycache.Get(ctx, key, &s)).NotTo(HaveOccurred())
+			Expect(s).To(Equal("redis"))
+
+			err = mycache.SetMulti([]*cache.Item{
+				{Ctx: ctx, Key: key, Value: "local", SetNX: true},
+				{Ctx: ctx, Key: "other", Value: "local", SetNX: true},
+				{Ctx: ctx, Key: "missing", Value: "local", SetXX: true},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(mycache.Get(ctx, key, &s)).NotTo(HaveOccurred())
+			Expect(s).To(Equal("redis"))
+			Expect(mycache.Get(ctx, "other", &s)).NotTo(HaveOccurred())
+			Expect(s).To(Equal("local"))
+			Expect(mycache.Exists(ctx, "missing")).To(BeFalse())
+		})
+
 		It("can be used with Incr", func() {
 			if rdb == nil {
 				return
@@ -147,6 +276,120 @@ var _ = Describe("Cache", func() {
 			Expect(n).To(Equal(int64(124)))
 		})
 
+		Describe("Multi funcs", func() {
+			It("Gets and Sets multiple items", func() {
+				err := mycache.SetMulti([]*cache.Item{
+					{Ctx: ctx, Key: "key1", Value: obj},
+					{Ctx: ctx, Key: "key2", Value: &Object{Str: "other"}},
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				dst := make(map[string]*Object)
+				err = mycache.GetMulti(ctx, []string{"key1", "key2", "key3"}, dst)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(dst).To(Equal(map[string]*Object{
+					"key1": obj,
+					"key2": {Str: "other"},
+				}))
+			})
+
+			It("Gets values set one by one", func() {
+				err := mycache.Set(&cache.Item{Ctx: ctx, Key: "key1", Value: "hello"})
+				Expect(err).NotTo(HaveOccurred())
+
+				dst := make(map[string]string)
+				err = mycache.GetMulti(ctx, []string{"key1", "key2"}, dst)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(dst).To(Equal(map[string]string{"key1": "hello"}))
+			})
+
+			It("rejects non-map dst", func() {
+				var dst []Object
+				err := mycache.GetMulti(ctx, []string{"key1"}, &dst)
+				Expect(err).To(MatchError("cache: dst must be a map with string keys, got *[]cache_test.Object"))
+			})
+
+			It("loads only missing keys with OnceMany", func() {
+				err := mycache.Set(&cache.Item{Ctx: ctx, Key: "key1", Value: obj})
+				Expect(err).NotTo(HaveOccurred())
+
+				var loaded []string
+				dst := make(map[string]*Object)
+				err = mycache.OnceMany(ctx, []string{"key1", "key2", "key3"}, time.Hour,
+					func(keys []string) (map[string]interface{}, error) {
+						loaded = keys
+						return map[string]interface{}{
+							"key2": &Object{Str: "loaded"},
+						}, nil
+					}, dst)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(loaded).To(Equal([]string{"key2", "key3"}))
+				Expect(dst).To(Equal(map[string]*Object{
+					"key1": obj,
+					"key2": {Str: "loaded"},
+				}))
+
+				got := new(Object)
+				err = mycache.Get(ctx, "key2", got)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(got).To(Equal(&Object{Str: "loaded"}))
+			})
+
+			It("deduplicates keys across OnceMany calls", func() {
+				var mu sync.Mutex
+				callCount := make(map[string]int)
+
+				perform(10, func(i int) {
+					keys := []string{"key1", "key2", fmt.Sprintf("key%d", i+3)}
+					dst := make(map[string]int)
+					err := mycache.OnceMany(ctx, keys, time.Hour,
+						func(keys []string) (map[string]interface{}, error) {
+							time.Sleep(10 * time.Millisecond)
+							values := make(map[string]interface{}, len(keys))
+							mu.Lock()
+							for _, key := range keys {
+								callCount[key]++
+								values[key] = len(key)
+							}
+							mu.Unlock()
+							return values, nil
+						}, dst)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(dst).To(HaveLen(3))
+				})
+
+				Expect(callCount).To(HaveLen(12))
+				for key, n := range callCount {
+					Expect(n).To(Equal(1), key)
+				}
+			})
+
+			It("does not cache OnceMany loader error", func() {
+				dst := make(map[string]*Object)
+				err := mycache.OnceMany(ctx, []string{"key1"}, time.Hour,
+					func(keys []string) (map[string]interface{}, error) {
+						return nil, io.EOF
+					}, dst)
+				Expect(err).To(Equal(io.EOF))
+				Expect(dst).To(BeEmpty())
+				Expect(mycache.Exists(ctx, "key1")).To(BeFalse())
+			})
+
+			It("Deletes multiple keys", func() {
+				err := mycache.SetMulti([]*cache.Item{
+					{Ctx: ctx, Key: "key1", Value: obj},
+					{Ctx: ctx, Key: "key2", Value: obj},
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				err = mycache.DeleteMulti(ctx, "key1", "key2")
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(mycache.Exists(ctx, "key1")).To(BeFalse())
+				Expect(mycache.Exists(ctx, "key2")).To(BeFalse())
+			})
+		})
+
 		Describe("Once func", func() {
 			It("calls Func when cache fails", func() {
 				err := mycache.Set(&cache.Item{
@@ -337,6 +580,171 @@ var _ = Describe("Cache", func() {
 				Expect(callCount).To(Equal(int64(2)))
 			})
 
+			It("returns stale value and refreshes it in background", func() {
+				var callCount int64
+				once := func() int64 {
+					var n int64
+					err := mycache.Once(&cache.Item{
+						Ctx:      ctx,
+						Key:      key,
+						Value:    &n,
+						TTL:      time.Second,
+						StaleTTL: time.Minute,
+						Do: func(*cache.Item) (interface{}, error) {
+							return atomic.AddInt64(&callCount, 1), nil
+						},
+					})
+					Expect(err).NotTo(HaveOccurred())
+					return n
+				}
+
+				Expect(once()).To(Equal(int64(1)))
+				Expect(once()).To(Equal(int64(1)))
+				Expect(atomic.LoadInt64(&callCount)).To(Equal(int64(1)))
+
+				if rdb != nil {
+					ttl, err := rdb.TTL(ctx, key).Result()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(ttl).To(BeNumerically(">", time.Second))
+				}
+
+				time.Sleep(2100 * time.Millisecond)
+
+				Expect(once()).To(Equal(int64(1)))
+				Eventually(func() int64 {
+					return atomic.LoadInt64(&callCount)
+				}).Should(Equal(int64(2)))
+				Eventually(once).Should(Equal(int64(2)))
+			})
+
+			It("does not refresh strings in stale-while-revalidate mode", func() {
+				// Strings are stored as is, without the write time.
+				const value = "caf\xc3\xa9"
+				err := mycache.Set(&cache.Item{Ctx: ctx, Key: key, Value: value})
+				Expect(err).NotTo(HaveOccurred())
+
+				var callCount int64
+				var s string
+				err = mycache.Once(&cache.Item{
+					Ctx:      ctx,
+					Key:      key,
+					Value:    &s,
+					StaleTTL: time.Minute,
+					Do: func(*cache.Item) (interface{}, error) {
+						return atomic.AddInt64(&callCount, 1), nil
+					},
+				})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(s).To(Equal(value))
+
+				Consistently(func() int64 {
+					return atomic.LoadInt64(&callCount)
+				}, "100ms").Should(Equal(int64(0)))
+			})
+
+			It("recomputes value before it expires", func() {
+				var callCount int64
+				once := func(beta float64) {
+					var n int64
+					err := mycache.Once(&cache.Item{
+						Ctx:        ctx,
+						Key:        key,
+						Value:      &n,
+						TTL:        time.Second,
+						XFetchBeta: beta,
+						Do: func(*cache.Item) (interface{}, error) {
+							time.Sleep(100 * time.Millisecond)
+							return atomic.AddInt64(&callCount, 1), nil
+						},
+					})
+					Expect(err).NotTo(HaveOccurred())
+					Expect(n).To(Equal(atomic.LoadInt64(&callCount)))
+				}
+
+				once(1e-9)
+				once(1e-9)
+				Expect(atomic.LoadInt64(&callCount)).To(Equal(int64(1)))
+
+				once(1e9)
+				Expect(atomic.LoadInt64(&callCount)).To(Equal(int64(2)))
+			})
+
+			It("does not recompute byte slices early", func() {
+				// Byte slices are stored as is, without the XFetch metadata.
+				value := []byte(`{"name":"abc"}`)
+				err := mycache.Set(&cache.Item{Ctx: ctx, Key: key, Value: value})
+				Expect(err).NotTo(HaveOccurred())
+
+				var callCount int64
+				for i := 0; i < 5; i++ {
+					var b []byte
+					err := mycache.Once(&cache.Item{
+						Ctx:        ctx,
+						Key:        key,
+						Value:      &b,
+						XFetchBeta: 1,
+						Do: func(*cache.Item) (interface{}, error) {
+							atomic.AddInt64(&callCount, 1)
+							return value, nil
+						},
+					})
+					Expect(err).NotTo(HaveOccurred())
+					Expect(b).To(Equal(value))
+				}
+				Expect(atomic.LoadInt64(&callCount)).To(Equal(int64(0)))
+			})
+
+			It("caches ErrNotFound for NegativeTTL", func() {
+				var callCount int64
+				once := func() error {
+					var got string
+					return mycache.Once(&cache.Item{
+						Ctx:         ctx,
+						Key:         key,
+						Value:       &got,
+						NegativeTTL: time.Minute,
+						Do: func(*cache.Item) (interface{}, error) {
+							atomic.AddInt64(&callCount, 1)
+							return nil, fmt.Errorf("user is missing: %w", cache.ErrNotFound)
+						},
+					})
+				}
+
+				Expect(once()).To(MatchError(cache.ErrNotFound))
+				Expect(once()).To(Equal(cache.ErrNotFound))
+				Expect(callCount).To(Equal(int64(1)))
+
+				var got string
+				err := mycache.Get(ctx, key, &got)
+				Expect(err).To(Equal(cache.ErrNotFound))
+				Expect(mycache.Exists(ctx, key)).To(BeFalse())
+
+				dst := make(map[string]string)
+				err = mycache.GetMulti(ctx, []string{key}, dst)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(dst).To(BeEmpty())
+
+				if rdb != nil {
+					ttl, err := rdb.TTL(ctx, key).Result()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(ttl).To(Equal(time.Minute))
+				}
+			})
+
+			It("does not cache ErrNotFound without NegativeTTL", func() {
+				err := mycache.Once(&cache.Item{
+					Ctx: ctx,
+					Key: key,
+					Do: func(*cache.Item) (interface{}, error) {
+						return nil, cache.ErrNotFound
+					},
+				})
+				Expect(err).To(Equal(cache.ErrNotFound))
+
+				err = mycache.Get(ctx, key, nil)
+				Expect(err).To(Equal(cache.ErrCacheMiss))
+			})
+
 			It("skips Set when TTL = -1", func() {
 				key := "skip-set"
 
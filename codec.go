@@ -0,0 +1,270 @@
+package cache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/s2"
+	"github.com/klauspost/compress/zstd"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Codec marshals and unmarshals cached values. Values of type string and
+// []byte are stored as is and are not passed to the codec.
+//
+// The id of the codec is stored in the payload header, so values written
+// with any of the built-in codecs can be read. Ids 1-15 are reserved for
+// the built-in codecs and the codecs in the extra packages, e.g. 4 for
+// extra/cacheproto; custom codecs must use ids 16-255.
+type Codec interface {
+	ID() byte
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+const (
+	msgpackCodecID = 0x1
+	jsonCodecID    = 0x2
+	gobCodecID     = 0x3
+)
+
+var (
+	// MsgpackCodec encodes values using MessagePack. It is the default.
+	MsgpackCodec Codec = msgpackCodec{}
+	// JSONCodec encodes values using encoding/json.
+	JSONCodec Codec = jsonCodec{}
+	// GobCodec encodes values using encoding/gob. Every value includes
+	// the type definition, so it is best suited for large values.
+	GobCodec Codec = gobCodec{}
+)
+
+var builtinCodecs = []Codec{MsgpackCodec, JSONCodec, GobCodec}
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) ID() byte { return msgpackCodecID }
+
+func (msgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	return msgpack.Marshal(v)
+}
+
+func (msgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	return msgpack.Unmarshal(data, v)
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) ID() byte { return jsonCodecID }
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+type gobCodec struct{}
+
+func (gobCodec) ID() byte { return gobCodecID }
+
+func (gobCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// codecSet maps codec ids to the codecs known to a Cache.
+type codecSet [256]Codec
+
+func newCodecSet(opt *Options) *codecSet {
+	set := new(codecSet)
+	for _, c := range builtinCodecs {
+		set[c.ID()] = c
+	}
+	if opt.Codec != nil {
+		if opt.Codec.ID() == 0 {
+			panic("cache: invalid codec id: 0")
+		}
+		set[opt.Codec.ID()] = opt.Codec
+	}
+	return set
+}
+
+func (set *codecSet) get(id byte) (Codec, error) {
+	if c := set[id]; c != nil {
+		return c, nil
+	}
+	return nil, fmt.Errorf("unknown codec: %x", id)
+}
+
+//------------------------------------------------------------------------------
+
+// Compressor compresses marshaled values. The id of the compressor is stored
+// in the payload header, so values written with any compressor known
+// to the Cache can be read. Id 0 means that the value is not compressed
+// and ids 1-15 are reserved for the built-in compressors and the compressors
+// in the extra packages, e.g. 4 for extra/cachelz4; custom compressors must
+// use ids 16-255.
+type Compressor interface {
+	ID() byte
+	Compress(data []byte) ([]byte, error)
+	Decompress(data []byte) ([]byte, error)
+}
+
+const (
+	s2CompressorID   = 0x1
+	zstdCompressorID = 0x2
+	gzipCompressorID = 0x3
+)
+
+var (
+	// S2Compressor compresses values using S2. It is the default.
+	S2Compressor Compressor = s2Compressor{}
+	// ZstdCompressor compresses values using Zstandard, which is slower
+	// than S2 but has a better compression ratio.
+	ZstdCompressor Compressor = zstdCompressor{}
+	// GzipCompressor compresses values using gzip.
+	GzipCompressor Compressor = gzipCompressor{}
+	// NoCompressor disables compression, like CompressionThreshold -1.
+	// Compressed values can still be read.
+	NoCompressor Compressor = noCompressor{}
+)
+
+var builtinCompressors = []Compressor{S2Compressor, ZstdCompressor, GzipCompressor}
+
+type noCompressor struct{}
+
+func (noCompressor) ID() byte { return noCompression }
+
+func (noCompressor) Compress(data []byte) ([]byte, error) {
+	return data, nil
+}
+
+func (noCompressor) Decompress(data []byte) ([]byte, error) {
+	return data, nil
+}
+
+type s2Compressor struct{}
+
+func (s2Compressor) ID() byte { return s2CompressorID }
+
+func (s2Compressor) Compress(data []byte) ([]byte, error) {
+	return s2.Encode(nil, data), nil
+}
+
+func (s2Compressor) Decompress(data []byte) ([]byte, error) {
+	return s2.Decode(nil, data)
+}
+
+var zstdCoder struct {
+	once sync.Once
+	enc  *zstd.Encoder
+	dec  *zstd.Decoder
+	err  error
+}
+
+// zstdCoders returns the shared Zstandard encoder and decoder,
+// which are safe for concurrent use by EncodeAll and DecodeAll.
+func zstdCoders() (*zstd.Encoder, *zstd.Decoder, error) {
+	zstdCoder.once.Do(func() {
+		zstdCoder.enc, zstdCoder.err = zstd.NewWriter(nil)
+		if zstdCoder.err != nil {
+			return
+		}
+		zstdCoder.dec, zstdCoder.err = zstd.NewReader(nil)
+	})
+	return zstdCoder.enc, zstdCoder.dec, zstdCoder.err
+}
+
+type zstdCompressor struct{}
+
+func (zstdCompressor) ID() byte { return zstdCompressorID }
+
+func (zstdCompressor) Compress(data []byte) ([]byte, error) {
+	enc, _, err := zstdCoders()
+	if err != nil {
+		return nil, err
+	}
+	return enc.EncodeAll(data, nil), nil
+}
+
+func (zstdCompressor) Decompress(data []byte) ([]byte, error) {
+	_, dec, err := zstdCoders()
+	if err != nil {
+		return nil, err
+	}
+	return dec.DecodeAll(data, nil)
+}
+
+type gzipCompressor struct{}
+
+func (gzipCompressor) ID() byte { return gzipCompressorID }
+
+func (gzipCompressor) Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gzipCompressor) Decompress(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// compressorSet maps compressor ids to the compressors known to a Cache.
+type compressorSet [256]Compressor
+
+func newCompressorSet(opt *Options) *compressorSet {
+	set := new(compressorSet)
+	for _, c := range builtinCompressors {
+		set.add(c)
+	}
+	for _, c := range opt.Decompressors {
+		set.add(c)
+	}
+	if opt.Compressor != nil && opt.Compressor.ID() != noCompression {
+		set.add(opt.Compressor)
+	}
+	return set
+}
+
+func (set *compressorSet) add(c Compressor) {
+	id := c.ID()
+	if id == noCompression {
+		panic(fmt.Sprintf("cache: invalid compressor id: %d", id))
+	}
+	set[id] = c
+}
+
+func (set *compressorSet) decompress(method byte, data []byte) ([]byte, error) {
+	if method == noCompression {
+		return data, nil
+	}
+	c := set[method]
+	if c == nil {
+		return nil, fmt.Errorf("unknown compression method: %x", method)
+	}
+	return c.Decompress(data)
+}
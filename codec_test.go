@@ -0,0 +1,199 @@
+package cache_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/s2"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/redis/go-redis/v9"
+	"github.com/vmihailenco/msgpack/v5"
+
+	"github.com/go-redis/cache/v9"
+)
+
+// reverseCompressor is a custom compressor used to test migrations.
+type reverseCompressor struct{}
+
+func (reverseCompressor) ID() byte { return 0x10 }
+
+func (reverseCompressor) Compress(data []byte) ([]byte, error) {
+	return reverse(data), nil
+}
+
+func (reverseCompressor) Decompress(data []byte) ([]byte, error) {
+	return reverse(data), nil
+}
+
+func reverse(data []byte) []byte {
+	b := make([]byte, len(data))
+	for i, c := range data {
+		b[len(b)-1-i] = c
+	}
+	return b
+}
+
+var _ = Describe("Codec", func() {
+	ctx := context.TODO()
+
+	const key = "mykey"
+
+	var rdb *redis.Ring
+	var obj *Object
+
+	BeforeEach(func() {
+		rdb = newRing()
+		obj = &Object{
+			Str: strings.Repeat("my very large string", 10),
+			Num: 42,
+		}
+	})
+
+	roundTrip := func(mycache *cache.Cache) {
+		err := mycache.Set(&cache.Item{Ctx: ctx, Key: key, Value: obj})
+		Expect(err).NotTo(HaveOccurred())
+
+		wanted := new(Object)
+		err = mycache.Get(ctx, key, wanted)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(wanted).To(Equal(obj))
+	}
+
+	for _, codec := range []cache.Codec{cache.MsgpackCodec, cache.JSONCodec, cache.GobCodec} {
+		for _, compressor := range []cache.Compressor{
+			cache.S2Compressor, cache.ZstdCompressor, cache.GzipCompressor,
+			cache.NoCompressor, reverseCompressor{},
+		} {
+			codec, compressor := codec, compressor
+
+			It(fmt.Sprintf("round trips values with %T and %T", codec, compressor), func() {
+				roundTrip(cache.New(&cache.Options{
+					Redis:      rdb,
+					Codec:      codec,
+					Compressor: compressor,
+				}))
+			})
+		}
+	}
+
+	It("reads values written by another built-in compressor", func() {
+		roundTrip(cache.New(&cache.Options{
+			Redis:      rdb,
+			Compressor: cache.ZstdCompressor,
+		}))
+
+		mycache := cache.New(&cache.Options{Redis: rdb})
+		wanted := new(Object)
+		err := mycache.Get(ctx, key, wanted)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(wanted).To(Equal(obj))
+	})
+
+	It("reads values written by Decompressors", func() {
+		roundTrip(cache.New(&cache.Options{
+			Redis:      rdb,
+			Compressor: reverseCompressor{},
+		}))
+
+		wanted := new(Object)
+		err := cache.New(&cache.Options{Redis: rdb}).Get(ctx, key, wanted)
+		Expect(err).To(MatchError("unknown compression method: 10"))
+
+		mycache := cache.New(&cache.Options{
+			Redis:         rdb,
+			Decompressors: []cache.Compressor{reverseCompressor{}},
+		})
+		err = mycache.Get(ctx, key, wanted)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(wanted).To(Equal(obj))
+	})
+
+	It("respects CompressionThreshold", func() {
+		mycache := cache.New(&cache.Options{
+			Redis:                rdb,
+			Compressor:           reverseCompressor{},
+			CompressionThreshold: -1,
+		})
+		roundTrip(mycache)
+
+		b, err := rdb.Get(ctx, key).Bytes()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(bytes.Contains(b, []byte(obj.Str))).To(BeTrue())
+
+		meta, err := mycache.Inspect(b)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(meta.Compressor).To(Equal(byte(0)))
+	})
+
+	It("does not compress values with NoCompressor", func() {
+		mycache := cache.New(&cache.Options{
+			Redis:      rdb,
+			Compressor: cache.NoCompressor,
+		})
+		roundTrip(mycache)
+
+		b, err := rdb.Get(ctx, key).Bytes()
+		Expect(err).NotTo(HaveOccurred())
+
+		meta, err := mycache.Inspect(b)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(meta.Compressor).To(Equal(byte(0)))
+	})
+
+	It("inspects the payload header", func() {
+		mycache := cache.New(&cache.Options{
+			Redis:      rdb,
+			Codec:      cache.JSONCodec,
+			Compressor: cache.ZstdCompressor,
+		})
+		roundTrip(mycache)
+
+		b, err := rdb.Get(ctx, key).Bytes()
+		Expect(err).NotTo(HaveOccurred())
+
+		meta, err := mycache.Inspect(b)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(meta.Version).NotTo(BeZero())
+		Expect(meta.CreatedAt).To(BeTemporally("~", time.Now(), time.Second))
+		Expect(meta.Codec).To(Equal(cache.JSONCodec.ID()))
+		Expect(meta.Compressor).To(Equal(cache.ZstdCompressor.ID()))
+		Expect(meta.ExpireAt.IsZero()).To(BeTrue())
+	})
+
+	It("reads values in the legacy trailer format", func() {
+		mycache := cache.New(&cache.Options{Redis: rdb})
+
+		data, err := msgpack.Marshal(obj)
+		Expect(err).NotTo(HaveOccurred())
+
+		for _, b := range [][]byte{
+			append(data, 0x0),
+			append(s2.Encode(nil, data), 0x1),
+		} {
+			err := rdb.Set(ctx, key, b, 0).Err()
+			Expect(err).NotTo(HaveOccurred())
+
+			wanted := new(Object)
+			err = mycache.Get(ctx, key, wanted)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(wanted).To(Equal(obj))
+
+			meta, err := mycache.Inspect(b)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(meta.Version).To(BeZero())
+			Expect(meta.Codec).To(Equal(cache.MsgpackCodec.ID()))
+			Expect(meta.Compressor).To(Equal(b[len(b)-1]))
+		}
+	})
+
+	It("does not inspect values not encoded by Marshal", func() {
+		mycache := cache.New(&cache.Options{Redis: rdb})
+
+		_, err := mycache.Inspect([]byte("hello world"))
+		Expect(err).To(HaveOccurred())
+	})
+})
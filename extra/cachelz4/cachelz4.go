@@ -0,0 +1,40 @@
+// Package cachelz4 provides a go-redis/cache compressor that compresses
+// values using the LZ4 frame format.
+package cachelz4
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/pierrec/lz4/v4"
+
+	"github.com/go-redis/cache/v9"
+)
+
+// compressorID is reserved for this compressor by the cache package.
+const compressorID = 0x4
+
+// Compressor compresses values using the LZ4 frame format. Use it as
+// Options.Compressor; caches that read the values must use it too,
+// e.g. in Options.Decompressors.
+var Compressor cache.Compressor = compressor{}
+
+type compressor struct{}
+
+func (compressor) ID() byte { return compressorID }
+
+func (compressor) Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := lz4.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (compressor) Decompress(data []byte) ([]byte, error) {
+	return io.ReadAll(lz4.NewReader(bytes.NewReader(data)))
+}
@@ -0,0 +1,43 @@
+package cachelz4_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/go-redis/cache/extra/cachelz4/v9"
+	"github.com/go-redis/cache/v9"
+)
+
+type object struct {
+	Str string
+	Num int
+}
+
+func TestCompressor(t *testing.T) {
+	cd := cache.New(&cache.Options{Compressor: cachelz4.Compressor})
+
+	obj := &object{Str: strings.Repeat("my very large string", 10), Num: 42}
+	b, err := cd.Marshal(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	meta, err := cd.Inspect(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Compressor != cachelz4.Compressor.ID() {
+		t.Fatalf("got compressor %x, wanted %x", meta.Compressor, cachelz4.Compressor.ID())
+	}
+
+	// Caches using another compressor can read the values.
+	reader := cache.New(&cache.Options{Decompressors: []cache.Compressor{cachelz4.Compressor}})
+
+	wanted := new(object)
+	if err := reader.Unmarshal(b, wanted); err != nil {
+		t.Fatal(err)
+	}
+	if *wanted != *obj {
+		t.Fatalf("got %+v, wanted %+v", wanted, obj)
+	}
+}
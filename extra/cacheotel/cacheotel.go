@@ -0,0 +1,78 @@
+// Package cacheotel instruments go-redis/cache with OpenTelemetry tracing
+// and metrics using cache hooks.
+package cacheotel
+
+import (
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumName = "github.com/go-redis/cache/extra/cacheotel"
+
+type config struct {
+	tp     trace.TracerProvider
+	mp     metric.MeterProvider
+	attrs  []attribute.KeyValue
+	prefix func(key string) string
+}
+
+func newConfig(opts []Option) *config {
+	conf := &config{
+		tp:     otel.GetTracerProvider(),
+		mp:     otel.GetMeterProvider(),
+		prefix: defaultKeyPrefix,
+	}
+	for _, opt := range opts {
+		opt(conf)
+	}
+	return conf
+}
+
+// defaultKeyPrefix returns the part of the key before the first colon,
+// e.g. "user" for "user:123".
+func defaultKeyPrefix(key string) string {
+	if i := strings.IndexByte(key, ':'); i >= 0 {
+		return key[:i]
+	}
+	return ""
+}
+
+// Option configures the instrumentation.
+type Option func(conf *config)
+
+// WithTracerProvider specifies a tracer provider to use for creating a tracer.
+// If none is specified, the global provider is used.
+func WithTracerProvider(provider trace.TracerProvider) Option {
+	return func(conf *config) {
+		conf.tp = provider
+	}
+}
+
+// WithMeterProvider specifies a meter provider to use for creating a meter.
+// If none is specified, the global provider is used.
+func WithMeterProvider(provider metric.MeterProvider) Option {
+	return func(conf *config) {
+		conf.mp = provider
+	}
+}
+
+// WithAttributes specifies additional attributes to be added to the spans
+// and metrics, e.g. the name of the cache.
+func WithAttributes(attrs ...attribute.KeyValue) Option {
+	return func(conf *config) {
+		conf.attrs = append(conf.attrs, attrs...)
+	}
+}
+
+// WithKeyPrefix specifies the function that extracts the key prefix reported
+// instead of the full key, which may contain sensitive data and has
+// unbounded cardinality. By default, the part before the first colon is used.
+func WithKeyPrefix(fn func(key string) string) Option {
+	return func(conf *config) {
+		conf.prefix = fn
+	}
+}
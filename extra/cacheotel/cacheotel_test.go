@@ -0,0 +1,205 @@
+package cacheotel_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/go-redis/cache/extra/cacheotel/v9"
+	"github.com/go-redis/cache/v9"
+)
+
+func newCache() *cache.Cache {
+	return cache.New(&cache.Options{
+		LocalCache: cache.NewTinyLFU(1000, time.Minute),
+	})
+}
+
+func once(t *testing.T, cd *cache.Cache, key string) {
+	var s string
+	err := cd.Once(&cache.Item{
+		Ctx:   context.Background(),
+		Key:   key,
+		Value: &s,
+		Do: func(*cache.Item) (interface{}, error) {
+			return "value", nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func attrValue(attrs []attribute.KeyValue, key attribute.Key) (attribute.Value, bool) {
+	for _, kv := range attrs {
+		if kv.Key == key {
+			return kv.Value, true
+		}
+	}
+	return attribute.Value{}, false
+}
+
+func TestInstrumentTracing(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+
+	cd := newCache()
+	if err := cacheotel.InstrumentTracing(cd, cacheotel.WithTracerProvider(provider)); err != nil {
+		t.Fatal(err)
+	}
+
+	once(t, cd, "user:1")
+	once(t, cd, "user:1")
+
+	spans := sr.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("got %d spans, wanted 3", len(spans))
+	}
+
+	do, loaded, cached := spans[0], spans[1], spans[2]
+	if do.Name() != "cache.do" || loaded.Name() != "cache.once" || cached.Name() != "cache.once" {
+		t.Fatalf("got spans %q, %q, %q", do.Name(), loaded.Name(), cached.Name())
+	}
+	if do.Parent().SpanID() != loaded.SpanContext().SpanID() {
+		t.Fatal("cache.do is not a child of cache.once")
+	}
+
+	if v, _ := attrValue(loaded.Attributes(), "cache.key_prefix"); v.AsString() != "user" {
+		t.Fatalf("got key prefix %q, wanted user", v.AsString())
+	}
+	if v, _ := attrValue(loaded.Attributes(), "cache.tier"); v.AsString() != "loader" {
+		t.Fatalf("got tier %q, wanted loader", v.AsString())
+	}
+	if _, ok := attrValue(loaded.Attributes(), "cache.loader.duration_ms"); !ok {
+		t.Fatal("loader duration is missing")
+	}
+	if v, _ := attrValue(cached.Attributes(), "cache.tier"); v.AsString() != "local" {
+		t.Fatalf("got tier %q, wanted local", v.AsString())
+	}
+	if v, _ := attrValue(cached.Attributes(), "cache.size"); v.AsInt64() != int64(len("value")) {
+		t.Fatalf("got size %d, wanted %d", v.AsInt64(), len("value"))
+	}
+}
+
+func onceMany(t *testing.T, cd *cache.Cache, keys ...string) {
+	m := make(map[string]string)
+	err := cd.OnceMany(context.Background(), keys, time.Hour,
+		func(keys []string) (map[string]interface{}, error) {
+			values := make(map[string]interface{}, len(keys))
+			for _, key := range keys {
+				values[key] = "value"
+			}
+			return values, nil
+		}, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInstrumentTracingMulti(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+
+	cd := newCache()
+	if err := cacheotel.InstrumentTracing(cd, cacheotel.WithTracerProvider(provider)); err != nil {
+		t.Fatal(err)
+	}
+
+	onceMany(t, cd, "user:1")
+	onceMany(t, cd, "user:1", "user:2")
+
+	spans := sr.Ended()
+	if len(spans) != 4 {
+		t.Fatalf("got %d spans, wanted 4", len(spans))
+	}
+
+	do, batch := spans[2], spans[3]
+	if do.Name() != "cache.do" || batch.Name() != "cache.once_many" {
+		t.Fatalf("got spans %q, %q", do.Name(), batch.Name())
+	}
+	if do.Parent().SpanID() != batch.SpanContext().SpanID() {
+		t.Fatal("cache.do is not a child of cache.once_many")
+	}
+
+	if v, _ := attrValue(do.Attributes(), "cache.key_count"); v.AsInt64() != 1 {
+		t.Fatalf("got %d loaded keys, wanted 1", v.AsInt64())
+	}
+	if v, _ := attrValue(batch.Attributes(), "cache.key_count"); v.AsInt64() != 2 {
+		t.Fatalf("got %d keys, wanted 2", v.AsInt64())
+	}
+	if v, _ := attrValue(batch.Attributes(), "cache.hit_count"); v.AsInt64() != 1 {
+		t.Fatalf("got %d hits, wanted 1", v.AsInt64())
+	}
+	if v, _ := attrValue(batch.Attributes(), "cache.key_prefix"); v.AsString() != "user" {
+		t.Fatalf("got key prefix %q, wanted user", v.AsString())
+	}
+}
+
+func TestInstrumentMetrics(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	cd := newCache()
+	err := cacheotel.InstrumentMetrics(cd,
+		cacheotel.WithMeterProvider(provider),
+		cacheotel.WithAttributes(attribute.String("cache", "users")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	once(t, cd, "user:1")
+	once(t, cd, "user:1")
+	var s string
+	if err := cd.Get(context.Background(), "user:2", &s); err != cache.ErrCacheMiss {
+		t.Fatalf("got %v, wanted ErrCacheMiss", err)
+	}
+	onceMany(t, cd, "user:1", "user:3")
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+
+	metrics := make(map[string]metricdata.Aggregation)
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			metrics[m.Name] = m.Data
+		}
+	}
+
+	sum := func(name string) int64 {
+		data, ok := metrics[name].(metricdata.Sum[int64])
+		if !ok {
+			t.Fatalf("metric %s is missing", name)
+		}
+		var n int64
+		for _, dp := range data.DataPoints {
+			if v, ok := dp.Attributes.Value("cache"); !ok || v.AsString() != "users" {
+				t.Fatalf("metric %s has no cache attribute", name)
+			}
+			n += dp.Value
+		}
+		return n
+	}
+
+	if n := sum("cache.hits"); n != 2 {
+		t.Fatalf("got %d hits, wanted 2", n)
+	}
+	if n := sum("cache.misses"); n != 3 {
+		t.Fatalf("got %d misses, wanted 3", n)
+	}
+
+	loader, ok := metrics["cache.loader.duration"].(metricdata.Histogram[float64])
+	if !ok || len(loader.DataPoints) != 1 || loader.DataPoints[0].Count != 2 {
+		t.Fatalf("got loader duration %+v, wanted 2 calls", metrics["cache.loader.duration"])
+	}
+	if _, ok := metrics["cache.payload.size"].(metricdata.Histogram[int64]); !ok {
+		t.Fatal("payload size is missing")
+	}
+}
@@ -0,0 +1,113 @@
+package cacheotel
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	"github.com/go-redis/cache/v9"
+)
+
+// InstrumentMetrics instruments the cache to report:
+//
+//   - cache.hits and cache.misses, with the tier that served the hit
+//     except for GetMulti and OnceMany, which count each key;
+//   - cache.loader.duration, a histogram of Item.Do latency;
+//   - cache.payload.size, a histogram of the encoded values sizes.
+func InstrumentMetrics(cd *cache.Cache, opts ...Option) error {
+	conf := newConfig(opts)
+	meter := conf.mp.Meter(instrumName)
+
+	hits, err := meter.Int64Counter("cache.hits",
+		metric.WithDescription("The number of cache hits"))
+	if err != nil {
+		return err
+	}
+
+	misses, err := meter.Int64Counter("cache.misses",
+		metric.WithDescription("The number of cache misses"))
+	if err != nil {
+		return err
+	}
+
+	loaderDuration, err := meter.Float64Histogram("cache.loader.duration",
+		metric.WithDescription("The duration of Item.Do calls"),
+		metric.WithUnit("ms"))
+	if err != nil {
+		return err
+	}
+
+	payloadSize, err := meter.Int64Histogram("cache.payload.size",
+		metric.WithDescription("The size of the encoded values"),
+		metric.WithUnit("By"))
+	if err != nil {
+		return err
+	}
+
+	cd.AddHook(&metricsHook{
+		attrs:          conf.attrs,
+		hits:           hits,
+		misses:         misses,
+		loaderDuration: loaderDuration,
+		payloadSize:    payloadSize,
+	})
+	return nil
+}
+
+type metricsHook struct {
+	attrs []attribute.KeyValue
+
+	hits           metric.Int64Counter
+	misses         metric.Int64Counter
+	loaderDuration metric.Float64Histogram
+	payloadSize    metric.Int64Histogram
+}
+
+var _ cache.Hook = (*metricsHook)(nil)
+
+func (h *metricsHook) BeforeOp(ctx context.Context, _ *cache.Event) context.Context {
+	return ctx
+}
+
+func (h *metricsHook) AfterOp(ctx context.Context, event *cache.Event) {
+	attrs := make([]attribute.KeyValue, 0, len(h.attrs)+3)
+	attrs = append(attrs, h.attrs...)
+	attrs = append(attrs, attribute.String("op", string(event.Op)))
+
+	switch event.Op {
+	case cache.OpGet, cache.OpOnce:
+		switch event.Tier {
+		case cache.TierLocal, cache.TierRedis:
+			attrs = append(attrs, tierAttr.String(string(event.Tier)))
+			h.hits.Add(ctx, 1, metric.WithAttributes(attrs...))
+		case cache.TierLoader:
+			h.misses.Add(ctx, 1, metric.WithAttributes(attrs...))
+		default:
+			if event.Err == cache.ErrCacheMiss {
+				h.misses.Add(ctx, 1, metric.WithAttributes(attrs...))
+			}
+		}
+	case cache.OpGetMulti, cache.OpOnceMany:
+		if event.Hits > 0 {
+			h.hits.Add(ctx, int64(event.Hits), metric.WithAttributes(attrs...))
+		}
+		if misses := len(event.Keys) - event.Hits; misses > 0 {
+			h.misses.Add(ctx, int64(misses), metric.WithAttributes(attrs...))
+		}
+	case cache.OpDo:
+		attrs = append(attrs, attribute.Bool("error", event.Err != nil))
+		h.loaderDuration.Record(ctx, milliseconds(event.Duration), metric.WithAttributes(attrs...))
+		return
+	}
+
+	// The sizes of the values of multi-key operations are not known.
+	if event.Size > 0 && event.Keys == nil {
+		h.payloadSize.Record(ctx, int64(event.Size), metric.WithAttributes(attrs...))
+	}
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,106 @@
+package cacheotel
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/go-redis/cache/v9"
+)
+
+const (
+	keyPrefixAttr      = attribute.Key("cache.key_prefix")
+	keyCountAttr       = attribute.Key("cache.key_count")
+	hitsAttr           = attribute.Key("cache.hit_count")
+	tierAttr           = attribute.Key("cache.tier")
+	sizeAttr           = attribute.Key("cache.size")
+	loaderDurationAttr = attribute.Key("cache.loader.duration_ms")
+)
+
+// InstrumentTracing instruments the cache to create a span for every Get,
+// Set, Delete, Once, and Item.Do call and their multi-key variants.
+// The spans of the multi-key operations report the number of keys and
+// the key prefix if all the keys share it.
+func InstrumentTracing(cd *cache.Cache, opts ...Option) error {
+	conf := newConfig(opts)
+	cd.AddHook(&tracingHook{
+		conf:   conf,
+		tracer: conf.tp.Tracer(instrumName),
+	})
+	return nil
+}
+
+type tracingHook struct {
+	conf   *config
+	tracer trace.Tracer
+}
+
+var _ cache.Hook = (*tracingHook)(nil)
+
+type parentSpanKey struct{}
+
+func (h *tracingHook) BeforeOp(ctx context.Context, event *cache.Event) context.Context {
+	if event.Op == cache.OpDo {
+		// Remember the span of the operation that calls the loader.
+		ctx = context.WithValue(ctx, parentSpanKey{}, trace.SpanFromContext(ctx))
+	}
+
+	attrs := make([]attribute.KeyValue, 0, len(h.conf.attrs)+2)
+	attrs = append(attrs, h.conf.attrs...)
+	if event.Keys == nil {
+		attrs = append(attrs, keyPrefixAttr.String(h.conf.prefix(event.Key)))
+	} else {
+		attrs = append(attrs, keyCountAttr.Int(len(event.Keys)))
+		if prefix, ok := h.commonPrefix(event.Keys); ok {
+			attrs = append(attrs, keyPrefixAttr.String(prefix))
+		}
+	}
+
+	ctx, _ = h.tracer.Start(ctx, "cache."+string(event.Op),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...))
+	return ctx
+}
+
+func (h *tracingHook) AfterOp(ctx context.Context, event *cache.Event) {
+	span := trace.SpanFromContext(ctx)
+
+	if event.Tier != cache.TierNone {
+		span.SetAttributes(tierAttr.String(string(event.Tier)))
+	}
+	if event.Op == cache.OpGetMulti || event.Op == cache.OpOnceMany {
+		span.SetAttributes(hitsAttr.Int(event.Hits))
+	}
+	if event.Size > 0 {
+		span.SetAttributes(sizeAttr.Int(event.Size))
+	}
+	if event.Op == cache.OpDo {
+		ms := float64(event.Duration.Microseconds()) / 1000
+		span.SetAttributes(loaderDurationAttr.Float64(ms))
+		if parent, ok := ctx.Value(parentSpanKey{}).(trace.Span); ok {
+			parent.SetAttributes(loaderDurationAttr.Float64(ms))
+		}
+	}
+	if err := event.Err; err != nil && err != cache.ErrCacheMiss {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
+
+// commonPrefix returns the prefix of the keys if all of them share it.
+func (h *tracingHook) commonPrefix(keys []string) (string, bool) {
+	if len(keys) == 0 {
+		return "", false
+	}
+	prefix := h.conf.prefix(keys[0])
+	for _, key := range keys[1:] {
+		if h.conf.prefix(key) != prefix {
+			return "", false
+		}
+	}
+	return prefix, true
+}
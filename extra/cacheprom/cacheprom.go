@@ -0,0 +1,112 @@
+// Package cacheprom exports go-redis/cache statistics to Prometheus.
+package cacheprom
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/go-redis/cache/v9"
+)
+
+// Collector is a prometheus.Collector that exposes Cache.Stats.
+// The cache must be created with Options.StatsEnabled. Metrics are
+// labelled with the cache name from Options.Name.
+type Collector struct {
+	cd *cache.Cache
+
+	localHits          *prometheus.Desc
+	localMisses        *prometheus.Desc
+	redisHits          *prometheus.Desc
+	redisMisses        *prometheus.Desc
+	redisErrors        *prometheus.Desc
+	loaderCalls        *prometheus.Desc
+	loaderErrors       *prometheus.Desc
+	singleflightDedups *prometheus.Desc
+	bytesRead          *prometheus.Desc
+	bytesWritten       *prometheus.Desc
+	unmarshalErrors    *prometheus.Desc
+	localCacheSize     *prometheus.Desc
+}
+
+var _ prometheus.Collector = (*Collector)(nil)
+
+// NewCollector returns a collector for the cache.
+func NewCollector(cd *cache.Cache) *Collector {
+	labels := prometheus.Labels{"cache": cd.Name()}
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc("cache_"+name, help, nil, labels)
+	}
+
+	return &Collector{
+		cd: cd,
+
+		localHits: desc("local_hits_total",
+			"The number of values found in the local cache."),
+		localMisses: desc("local_misses_total",
+			"The number of values not found in the local cache."),
+		redisHits: desc("redis_hits_total",
+			"The number of values found in Redis."),
+		redisMisses: desc("redis_misses_total",
+			"The number of values not found in Redis."),
+		redisErrors: desc("redis_errors_total",
+			"The number of failed Redis commands and pipelines."),
+		loaderCalls: desc("loader_calls_total",
+			"The number of loader calls."),
+		loaderErrors: desc("loader_errors_total",
+			"The number of loader calls that failed."),
+		singleflightDedups: desc("singleflight_dedups_total",
+			"The number of calls that got the result of a concurrent call."),
+		bytesRead: desc("read_bytes_total",
+			"The number of value bytes read from Redis."),
+		bytesWritten: desc("written_bytes_total",
+			"The number of value bytes written to Redis."),
+		unmarshalErrors: desc("unmarshal_errors_total",
+			"The number of values that could not be decoded."),
+		localCacheSize: desc("local_size",
+			"The number of entries in the local cache."),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.localHits
+	ch <- c.localMisses
+	ch <- c.redisHits
+	ch <- c.redisMisses
+	ch <- c.redisErrors
+	ch <- c.loaderCalls
+	ch <- c.loaderErrors
+	ch <- c.singleflightDedups
+	ch <- c.bytesRead
+	ch <- c.bytesWritten
+	ch <- c.unmarshalErrors
+	ch <- c.localCacheSize
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.cd.Stats()
+	if stats == nil {
+		return
+	}
+
+	counter := func(desc *prometheus.Desc, n uint64) {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, float64(n))
+	}
+
+	counter(c.localHits, stats.LocalHits)
+	counter(c.localMisses, stats.LocalMisses)
+	counter(c.redisHits, stats.RedisHits)
+	counter(c.redisMisses, stats.RedisMisses)
+	counter(c.redisErrors, stats.RedisErrors)
+	counter(c.loaderCalls, stats.LoaderCalls)
+	counter(c.loaderErrors, stats.LoaderErrors)
+	counter(c.singleflightDedups, stats.SingleflightDedups)
+	counter(c.bytesRead, stats.BytesRead)
+	counter(c.bytesWritten, stats.BytesWritten)
+	counter(c.unmarshalErrors, stats.UnmarshalErrors)
+
+	if stats.LocalCacheSize >= 0 {
+		ch <- prometheus.MustNewConstMetric(
+			c.localCacheSize, prometheus.GaugeValue, float64(stats.LocalCacheSize))
+	}
+}
@@ -0,0 +1,68 @@
+package cacheprom_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/go-redis/cache/extra/cacheprom/v9"
+	"github.com/go-redis/cache/v9"
+)
+
+func TestCollector(t *testing.T) {
+	cd := cache.New(&cache.Options{
+		Name:         "users",
+		LocalCache:   cache.NewTinyLFU(1000, time.Minute),
+		StatsEnabled: true,
+	})
+
+	for i := 0; i < 2; i++ {
+		var s string
+		err := cd.Once(&cache.Item{
+			Ctx:   context.Background(),
+			Key:   "user:1",
+			Value: &s,
+			Do: func(*cache.Item) (interface{}, error) {
+				return "value", nil
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	collector := cacheprom.NewCollector(cd)
+
+	expected := `
+# HELP cache_local_hits_total The number of values found in the local cache.
+# TYPE cache_local_hits_total counter
+cache_local_hits_total{cache="users"} 1
+# HELP cache_loader_calls_total The number of loader calls.
+# TYPE cache_loader_calls_total counter
+cache_loader_calls_total{cache="users"} 1
+# HELP cache_local_size The number of entries in the local cache.
+# TYPE cache_local_size gauge
+cache_local_size{cache="users"} 1
+`
+	err := testutil.CollectAndCompare(collector, strings.NewReader(expected),
+		"cache_local_hits_total", "cache_loader_calls_total", "cache_local_size")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := testutil.CollectAndCount(collector); n != 12 {
+		t.Fatalf("got %d metrics, wanted 12", n)
+	}
+}
+
+func TestCollectorStatsDisabled(t *testing.T) {
+	cd := cache.New(&cache.Options{
+		LocalCache: cache.NewTinyLFU(1000, time.Minute),
+	})
+	if n := testutil.CollectAndCount(cacheprom.NewCollector(cd)); n != 0 {
+		t.Fatalf("got %d metrics, wanted 0", n)
+	}
+}
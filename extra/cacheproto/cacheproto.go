@@ -0,0 +1,39 @@
+// Package cacheproto provides a go-redis/cache codec that encodes values
+// using Protocol Buffers.
+package cacheproto
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/go-redis/cache/v9"
+)
+
+// codecID is reserved for this codec by the cache package.
+const codecID = 0x4
+
+// Codec encodes values using Protocol Buffers. The values must implement
+// proto.Message. Use it as Options.Codec; caches that read the values
+// must use it too.
+var Codec cache.Codec = codec{}
+
+type codec struct{}
+
+func (codec) ID() byte { return codecID }
+
+func (codec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("cacheproto: value must implement proto.Message, got %T", v)
+	}
+	return proto.Marshal(m)
+}
+
+func (codec) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("cacheproto: value must implement proto.Message, got %T", v)
+	}
+	return proto.Unmarshal(data, m)
+}
@@ -0,0 +1,46 @@
+package cacheproto_test
+
+import (
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/go-redis/cache/extra/cacheproto/v9"
+	"github.com/go-redis/cache/v9"
+)
+
+func TestCodec(t *testing.T) {
+	cd := cache.New(&cache.Options{Codec: cacheproto.Codec})
+
+	msg := wrapperspb.String(strings.Repeat("my very large string", 10))
+	b, err := cd.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	meta, err := cd.Inspect(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Codec != cacheproto.Codec.ID() {
+		t.Fatalf("got codec %x, wanted %x", meta.Codec, cacheproto.Codec.ID())
+	}
+
+	wanted := new(wrapperspb.StringValue)
+	if err := cd.Unmarshal(b, wanted); err != nil {
+		t.Fatal(err)
+	}
+	if wanted.GetValue() != msg.GetValue() {
+		t.Fatalf("got %q, wanted %q", wanted.GetValue(), msg.GetValue())
+	}
+}
+
+func TestCodecRequiresMessage(t *testing.T) {
+	cd := cache.New(&cache.Options{Codec: cacheproto.Codec})
+
+	_, err := cd.Marshal(struct{}{})
+	if err == nil || err.Error() != "cacheproto: value must implement proto.Message, got struct {}" {
+		t.Fatalf("got %v, wanted an error", err)
+	}
+}
@@ -0,0 +1,113 @@
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// Op is the cache operation reported to hooks.
+type Op string
+
+const (
+	OpGet    Op = "get"
+	OpSet    Op = "set"
+	OpDelete Op = "delete"
+	OpOnce   Op = "once"
+	OpTouch  Op = "touch"
+	// OpDo is the execution of Item.Do or the OnceMany loader.
+	OpDo Op = "do"
+
+	OpGetMulti    Op = "get_multi"
+	OpSetMulti    Op = "set_multi"
+	OpDeleteMulti Op = "delete_multi"
+	OpOnceMany    Op = "once_many"
+)
+
+// Tier is the place that served the value.
+type Tier string
+
+const (
+	TierNone   Tier = ""
+	TierLocal  Tier = "local"
+	TierRedis  Tier = "redis"
+	TierLoader Tier = "loader"
+)
+
+// Event describes a cache operation.
+type Event struct {
+	Op  Op
+	Key string
+	// Keys are the keys of GetMulti, SetMulti, DeleteMulti, OnceMany and
+	// the OnceMany loader. Key is empty for such operations.
+	Keys []string
+
+	// Tier is the tier that served the value for Get and Once, or
+	// TierNone if the value was not found.
+	Tier Tier
+	// Hits is the number of Keys found in the LocalCache or Redis by
+	// GetMulti and OnceMany.
+	Hits int
+	// Size is the size of the encoded value that was read or written,
+	// or the total size of the values for operations with Keys.
+	Size int
+
+	// Duration and Err are only set in AfterOp.
+	Duration time.Duration
+	Err      error
+}
+
+// Hook is called around cache operations, e.g. to add tracing, logging
+// or metrics. Hooks are called in the order they were added in BeforeOp
+// and in the reverse order in AfterOp.
+type Hook interface {
+	// BeforeOp is called before the operation. The returned context is
+	// passed to the operation, the following hooks, and AfterOp.
+	BeforeOp(ctx context.Context, event *Event) context.Context
+	// AfterOp is called after the operation with the same event.
+	AfterOp(ctx context.Context, event *Event)
+}
+
+// AddHook adds the hook to the cache. It is not safe to call AddHook
+// concurrently with other cache operations.
+func (cd *Cache) AddHook(hook Hook) {
+	cd.hooks = append(cd.hooks, hook)
+}
+
+// withHooks runs fn between the hooks. fn can update the event,
+// e.g. to report the tier that served the value.
+func (cd *Cache) withHooks(ctx context.Context, event *Event, fn func(ctx context.Context) error) error {
+	if len(cd.hooks) == 0 {
+		return fn(ctx)
+	}
+
+	for _, hook := range cd.hooks {
+		ctx = hook.BeforeOp(ctx, event)
+	}
+
+	start := time.Now()
+	event.Err = fn(ctx)
+	event.Duration = time.Since(start)
+
+	for i := len(cd.hooks) - 1; i >= 0; i-- {
+		cd.hooks[i].AfterOp(ctx, event)
+	}
+	return event.Err
+}
+
+// withItemHooks is like withHooks, but passes the context returned by
+// the hooks to fn via item.Ctx, which is restored when fn returns. The item
+// must be private to the operation, see itemWithKey.
+func (cd *Cache) withItemHooks(item *Item, event *Event, fn func(item *Item) error) error {
+	if len(cd.hooks) == 0 {
+		return fn(item)
+	}
+
+	return cd.withHooks(item.Context(), event, func(ctx context.Context) error {
+		parent := item.Ctx
+		item.Ctx = ctx
+		defer func() {
+			item.Ctx = parent
+		}()
+		return fn(item)
+	})
+}
@@ -0,0 +1,249 @@
+package cache_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/go-redis/cache/v9"
+)
+
+type hookCtxKey struct{}
+
+type recordingHook struct {
+	mu     sync.Mutex
+	name   string
+	calls  *[]string
+	events []cache.Event
+}
+
+func (h *recordingHook) BeforeOp(ctx context.Context, event *cache.Event) context.Context {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	*h.calls = append(*h.calls, h.name+" before "+string(event.Op))
+	return context.WithValue(ctx, hookCtxKey{}, h.name)
+}
+
+func (h *recordingHook) AfterOp(ctx context.Context, event *cache.Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	*h.calls = append(*h.calls, h.name+" after "+string(event.Op))
+	h.events = append(h.events, *event)
+}
+
+var _ = Describe("Hooks", func() {
+	ctx := context.TODO()
+
+	const key = "mykey"
+
+	var rdb *redis.Ring
+	var mycache *cache.Cache
+	var calls []string
+	var hook1, hook2 *recordingHook
+
+	BeforeEach(func() {
+		rdb = newRing()
+		mycache = newCacheWithLocal(rdb)
+
+		calls = nil
+		hook1 = &recordingHook{name: "hook1", calls: &calls}
+		hook2 = &recordingHook{name: "hook2", calls: &calls}
+		mycache.AddHook(hook1)
+		mycache.AddHook(hook2)
+	})
+
+	It("calls hooks in order", func() {
+		err := mycache.Set(&cache.Item{Ctx: ctx, Key: key, Value: "value"})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(calls).To(Equal([]string{
+			"hook1 before set",
+			"hook2 before set",
+			"hook2 after set",
+			"hook1 after set",
+		}))
+
+		Expect(hook1.events).To(HaveLen(1))
+		event := hook1.events[0]
+		Expect(event.Key).To(Equal(key))
+		Expect(event.Size).To(Equal(len("value")))
+		Expect(event.Duration).To(BeNumerically(">", 0))
+		Expect(event.Err).NotTo(HaveOccurred())
+	})
+
+	It("reports the tier that served Get", func() {
+		var s string
+		err := mycache.Get(ctx, key, &s)
+		Expect(err).To(Equal(cache.ErrCacheMiss))
+
+		err = rdb.Set(ctx, key, "value", time.Hour).Err()
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(mycache.Get(ctx, key, &s)).NotTo(HaveOccurred())
+		Expect(mycache.Get(ctx, key, &s)).NotTo(HaveOccurred())
+
+		Expect(hook1.events).To(HaveLen(3))
+		Expect(hook1.events[0].Tier).To(Equal(cache.TierNone))
+		Expect(hook1.events[0].Err).To(Equal(cache.ErrCacheMiss))
+		Expect(hook1.events[1].Tier).To(Equal(cache.TierRedis))
+		Expect(hook1.events[2].Tier).To(Equal(cache.TierLocal))
+		Expect(hook1.events[2].Size).To(Equal(len("value")))
+	})
+
+	It("reports Once and Do", func() {
+		var doCtx context.Context
+		var s string
+		err := mycache.Once(&cache.Item{
+			Ctx:   ctx,
+			Key:   key,
+			Value: &s,
+			Do: func(item *cache.Item) (interface{}, error) {
+				doCtx = item.Context()
+				return "value", nil
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(calls).To(Equal([]string{
+			"hook1 before once",
+			"hook2 before once",
+			"hook1 before do",
+			"hook2 before do",
+			"hook2 after do",
+			"hook1 after do",
+			"hook2 after once",
+			"hook1 after once",
+		}))
+		Expect(doCtx.Value(hookCtxKey{})).To(Equal("hook2"))
+
+		Expect(hook1.events[0].Op).To(Equal(cache.OpDo))
+		Expect(hook1.events[1].Op).To(Equal(cache.OpOnce))
+		Expect(hook1.events[1].Tier).To(Equal(cache.TierLoader))
+	})
+
+	It("does not modify the item", func() {
+		// hook1 and hook2 share calls, so use a single hook.
+		mycache := newCacheWithLocal(rdb)
+		mycache.AddHook(&recordingHook{name: "hook", calls: new([]string)})
+
+		item := &cache.Item{
+			Ctx: ctx,
+			Key: key,
+			Do: func(*cache.Item) (interface{}, error) {
+				return "value", nil
+			},
+		}
+
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+
+				Expect(mycache.Once(item)).NotTo(HaveOccurred())
+				Expect(mycache.Set(item)).NotTo(HaveOccurred())
+			}()
+		}
+		wg.Wait()
+
+		Expect(item.Ctx).To(Equal(ctx))
+	})
+
+	It("keeps the changes made by Do", func() {
+		do := func(item *cache.Item) (interface{}, error) {
+			item.TTL = 5 * time.Minute
+			return "value", nil
+		}
+
+		err := mycache.Set(&cache.Item{Ctx: ctx, Key: key, Do: do})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rdb.PTTL(ctx, key).Val()).To(BeNumerically("~", 5*time.Minute, time.Second))
+
+		Expect(mycache.Delete(ctx, key)).NotTo(HaveOccurred())
+
+		err = mycache.Once(&cache.Item{Ctx: ctx, Key: key, Do: do})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rdb.PTTL(ctx, key).Val()).To(BeNumerically("~", 5*time.Minute, time.Second))
+	})
+
+	It("reports multi operations", func() {
+		err := mycache.SetMulti([]*cache.Item{
+			{Ctx: ctx, Key: "k1", Value: "value"},
+			{Ctx: ctx, Key: "k2", Value: "value"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		m := make(map[string]string)
+		Expect(mycache.GetMulti(ctx, []string{"k1", "k3"}, m)).NotTo(HaveOccurred())
+
+		err = mycache.OnceMany(ctx, []string{"k1", "k4"}, time.Hour,
+			func(keys []string) (map[string]interface{}, error) {
+				return map[string]interface{}{"k4": "value"}, nil
+			}, m)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(mycache.DeleteMulti(ctx, "k1", "k2")).NotTo(HaveOccurred())
+
+		Expect(calls).To(Equal([]string{
+			"hook1 before set_multi",
+			"hook2 before set_multi",
+			"hook2 after set_multi",
+			"hook1 after set_multi",
+			"hook1 before get_multi",
+			"hook2 before get_multi",
+			"hook2 after get_multi",
+			"hook1 after get_multi",
+			"hook1 before once_many",
+			"hook2 before once_many",
+			"hook1 before do",
+			"hook2 before do",
+			"hook2 after do",
+			"hook1 after do",
+			"hook2 after once_many",
+			"hook1 after once_many",
+			"hook1 before delete_multi",
+			"hook2 before delete_multi",
+			"hook2 after delete_multi",
+			"hook1 after delete_multi",
+		}))
+
+		events := hook1.events
+		Expect(events[0].Keys).To(Equal([]string{"k1", "k2"}))
+		Expect(events[0].Size).To(BeNumerically(">", 0))
+		Expect(events[1].Keys).To(Equal([]string{"k1", "k3"}))
+		Expect(events[1].Hits).To(Equal(1))
+		Expect(events[2].Keys).To(Equal([]string{"k4"}))
+		Expect(events[2].Tier).To(Equal(cache.TierLoader))
+		Expect(events[3].Keys).To(Equal([]string{"k1", "k4"}))
+		Expect(events[3].Hits).To(Equal(1))
+		Expect(events[4].Keys).To(Equal([]string{"k1", "k2"}))
+	})
+
+	It("reports errors", func() {
+		errDo := errors.New("do failed")
+		err := mycache.Once(&cache.Item{
+			Ctx: ctx,
+			Key: key,
+			Do: func(*cache.Item) (interface{}, error) {
+				return nil, errDo
+			},
+		})
+		Expect(err).To(Equal(errDo))
+
+		err = mycache.Delete(ctx, key)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(hook1.events).To(HaveLen(3))
+		Expect(hook1.events[0].Err).To(Equal(errDo))
+		Expect(hook1.events[1].Err).To(Equal(errDo))
+		Expect(hook1.events[2].Op).To(Equal(cache.OpDelete))
+	})
+})
@@ -0,0 +1,153 @@
+package cache
+
+import (
+	"context"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+const (
+	minResubscribeBackoff = 100 * time.Millisecond
+	maxResubscribeBackoff = 5 * time.Second
+)
+
+type publisher interface {
+	Publish(ctx context.Context, channel string, message interface{}) *redis.IntCmd
+}
+
+// invalidator evicts keys from the LocalCache when they are deleted or
+// overwritten by other Cache instances.
+type invalidator struct {
+	cd *Cache
+	id string
+
+	pubsub *redis.PubSub
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func newInvalidator(cd *Cache) *invalidator {
+	ctx, cancel := context.WithCancel(context.Background())
+	inv := &invalidator{
+		cd:     cd,
+		id:     randomID(),
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+
+	// Only instances with a LocalCache need to listen for invalidations.
+	if cd.opt.LocalCache == nil {
+		close(inv.done)
+		return inv
+	}
+
+	inv.pubsub = cd.opt.Redis.Subscribe(ctx, cd.opt.InvalidationChannel)
+	go inv.listen(ctx)
+	return inv
+}
+
+func (inv *invalidator) close() error {
+	inv.cancel()
+	var err error
+	if inv.pubsub != nil {
+		err = inv.pubsub.Close()
+	}
+	<-inv.done
+	return err
+}
+
+func (inv *invalidator) listen(ctx context.Context) {
+	defer close(inv.done)
+
+	receive(ctx, inv.pubsub, subscriptionHandler{
+		subscribed: inv.cd.resetLocalCache,
+		failed:     inv.cd.resetLocalCache,
+		message:    inv.handle,
+	})
+}
+
+func (inv *invalidator) handle(msg *redis.Message) {
+	var keys []string
+	if err := msgpack.Unmarshal([]byte(msg.Payload), &keys); err != nil {
+		log.Printf("cache: invalid invalidation message: %s", err)
+		return
+	}
+
+	// The first element is the id of the sender, which has already
+	// updated its own LocalCache.
+	if len(keys) == 0 || keys[0] == inv.id {
+		return
+	}
+	inv.cd.evictLocal(keys[1:])
+}
+
+// subscriptionHandler handles the events of a subscription to invalidations.
+type subscriptionHandler struct {
+	// subscribed is called when the subscription is (re)established.
+	subscribed func()
+	// failed is called when the subscription drops.
+	failed func()
+	// message is called for each received message.
+	message func(*redis.Message)
+}
+
+// receive reads messages from pubsub until ctx is canceled. PubSub reconnects
+// and resubscribes automatically, so receive only backs off on errors.
+// Invalidations sent while the subscription is down are lost, so handlers
+// usually reset the LocalCache both when it drops and when it is restored.
+func receive(ctx context.Context, pubsub *redis.PubSub, h subscriptionHandler) {
+	backoff := minResubscribeBackoff
+	for {
+		msg, err := pubsub.Receive(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+
+			h.failed()
+
+			if err := sleep(ctx, backoff); err != nil {
+				return
+			}
+			if backoff *= 2; backoff > maxResubscribeBackoff {
+				backoff = maxResubscribeBackoff
+			}
+			continue
+		}
+		backoff = minResubscribeBackoff
+
+		switch msg := msg.(type) {
+		case *redis.Subscription:
+			if msg.Kind == "subscribe" {
+				h.subscribed()
+			}
+		case *redis.Message:
+			h.message(msg)
+		}
+	}
+}
+
+// publish notifies other Cache instances that the keys were deleted or
+// overwritten. It does nothing if the invalidation bus is disabled.
+func (cd *Cache) publish(ctx context.Context, c publisher, keys ...string) {
+	if cd.invalidator == nil || len(keys) == 0 {
+		return
+	}
+
+	msg, err := msgpack.Marshal(append([]string{cd.invalidator.id}, keys...))
+	if err != nil {
+		return
+	}
+	c.Publish(ctx, cd.opt.InvalidationChannel, msg)
+}
+
+func (cd *Cache) resetLocalCache() {
+	atomic.AddUint64(&cd.invalidations, 1)
+	if c, ok := cd.opt.LocalCache.(LocalCacheWithReset); ok {
+		c.Reset()
+	}
+}
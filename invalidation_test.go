@@ -0,0 +1,77 @@
+package cache_test
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/go-redis/cache/v9"
+)
+
+var _ = Describe("Invalidation bus", func() {
+	ctx := context.TODO()
+
+	const key = "mykey"
+
+	var rdb *redis.Ring
+	var cache1, cache2 *cache.Cache
+
+	newBusCache := func() *cache.Cache {
+		return cache.New(&cache.Options{
+			Redis:               rdb,
+			LocalCache:          cache.NewTinyLFU(1000, time.Minute),
+			InvalidationChannel: "cache-invalidation",
+		})
+	}
+
+	get := func(c *cache.Cache) string {
+		var s string
+		err := c.Get(ctx, key, &s)
+		if err != nil {
+			return err.Error()
+		}
+		return s
+	}
+
+	BeforeEach(func() {
+		rdb = newRing()
+		cache1 = newBusCache()
+		cache2 = newBusCache()
+
+		err := cache1.Set(&cache.Item{Ctx: ctx, Key: key, Value: "v1"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(get(cache2)).To(Equal("v1"))
+	})
+
+	AfterEach(func() {
+		Expect(cache1.Close()).NotTo(HaveOccurred())
+		Expect(cache2.Close()).NotTo(HaveOccurred())
+	})
+
+	It("evicts overwritten keys from other instances", func() {
+		err := cache1.Set(&cache.Item{Ctx: ctx, Key: key, Value: "v2"})
+		Expect(err).NotTo(HaveOccurred())
+
+		Eventually(func() string { return get(cache2) }).Should(Equal("v2"))
+		Expect(get(cache1)).To(Equal("v2"))
+	})
+
+	It("evicts deleted keys from other instances", func() {
+		err := cache1.Delete(ctx, key)
+		Expect(err).NotTo(HaveOccurred())
+
+		Eventually(func() string { return get(cache2) }).Should(Equal(cache.ErrCacheMiss.Error()))
+	})
+
+	It("keeps own LocalCache", func() {
+		err := cache1.Set(&cache.Item{Ctx: ctx, Key: key, Value: "v2"})
+		Expect(err).NotTo(HaveOccurred())
+
+		// Make sure the value is served from LocalCache.
+		Expect(rdb.Del(ctx, key).Err()).NotTo(HaveOccurred())
+		Consistently(func() string { return get(cache1) }, "100ms").Should(Equal("v2"))
+	})
+})
@@ -14,15 +14,60 @@ type LocalCache interface {
 	Del(key string)
 }
 
+// LocalCacheWithTTL is implemented by local caches that support per-key
+// expiration. Cache uses it to make sure that values don't live in
+// the LocalCache longer than Item.TTL and Item.LocalTTL.
+type LocalCacheWithTTL interface {
+	LocalCache
+	SetWithTTL(key string, data []byte, ttl time.Duration)
+}
+
+// LocalCacheWithLen is implemented by local caches that can report
+// the number of entries, which is exposed in Stats.
+type LocalCacheWithLen interface {
+	LocalCache
+	Len() int
+}
+
+// LocalCacheWithReset is implemented by local caches that can drop all
+// entries at once. The invalidation bus and tracking use it to reset the
+// LocalCache when their subscription drops and invalidations may have been
+// missed; other local caches keep serving such stale entries until they
+// expire.
+type LocalCacheWithReset interface {
+	LocalCache
+	Reset()
+}
+
+// setLocalWithTTL uses SetWithTTL if c supports it. Zero ttl means
+// the default expiration time of c.
+func setLocalWithTTL(c LocalCache, key string, b []byte, ttl time.Duration) {
+	if c, ok := c.(LocalCacheWithTTL); ok && ttl > 0 {
+		c.SetWithTTL(key, b, ttl)
+		return
+	}
+	c.Set(key, b)
+}
+
+const tinyLFUSamples = 100000
+
 type TinyLFU struct {
 	mu     sync.Mutex
 	rand   *rand.Rand
 	lfu    *tinylfu.T
+	size   int
 	ttl    time.Duration
 	offset time.Duration
+
+	len     int
+	onEvict func()
 }
 
-var _ LocalCache = (*TinyLFU)(nil)
+var (
+	_ LocalCacheWithTTL   = (*TinyLFU)(nil)
+	_ LocalCacheWithLen   = (*TinyLFU)(nil)
+	_ LocalCacheWithReset = (*TinyLFU)(nil)
+)
 
 func NewTinyLFU(size int, ttl time.Duration) *TinyLFU {
 	const maxOffset = 10 * time.Second
@@ -32,12 +77,18 @@ func NewTinyLFU(size int, ttl time.Duration) *TinyLFU {
 		offset = maxOffset
 	}
 
-	return &TinyLFU{
+	c := &TinyLFU{
 		rand:   rand.New(rand.NewSource(time.Now().UnixNano())),
-		lfu:    tinylfu.New(size, 100000),
+		lfu:    tinylfu.New(size, tinyLFUSamples),
+		size:   size,
 		ttl:    ttl,
 		offset: offset,
 	}
+	// Evictions happen under c.mu.
+	c.onEvict = func() {
+		c.len--
+	}
+	return c
 }
 
 func (c *TinyLFU) UseRandomizedTTL(offset time.Duration) {
@@ -48,16 +99,53 @@ func (c *TinyLFU) Set(key string, b []byte) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	c.set(key, b, c.randomizedTTL(c.offset))
+}
+
+// SetWithTTL is like Set, but the entry never outlives ttl. If ttl is not
+// longer than the TTL of the cache, the entry expires after ttl. Otherwise
+// the randomization is limited, so the entry expires before ttl.
+func (c *TinyLFU) SetWithTTL(key string, b []byte, ttl time.Duration) {
+	if ttl <= 0 {
+		c.Set(key, b)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if ttl <= c.ttl {
+		c.set(key, b, ttl)
+		return
+	}
+
+	offset := c.offset
+	if limit := ttl - c.ttl; offset > limit {
+		offset = limit
+	}
+	c.set(key, b, c.randomizedTTL(offset))
+}
+
+// randomizedTTL returns the TTL of the cache plus a random duration
+// shorter than offset.
+func (c *TinyLFU) randomizedTTL(offset time.Duration) time.Duration {
 	ttl := c.ttl
-	if c.offset > 0 {
-		ttl += time.Duration(c.rand.Int63n(int64(c.offset)))
+	if offset > 0 {
+		ttl += time.Duration(c.rand.Int63n(int64(offset)))
 	}
+	return ttl
+}
 
+func (c *TinyLFU) set(key string, b []byte, ttl time.Duration) {
+	// Delete the previous entry, so it is not counted twice.
+	c.lfu.Del(key)
 	c.lfu.Set(&tinylfu.Item{
 		Key:      key,
 		Value:    b,
 		ExpireAt: time.Now().Add(ttl),
+		OnEvict:  c.onEvict,
 	})
+	c.len++
 }
 
 func (c *TinyLFU) Get(key string) ([]byte, bool) {
@@ -79,3 +167,24 @@ func (c *TinyLFU) Del(key string) {
 
 	c.lfu.Del(key)
 }
+
+// Reset removes all entries from the cache.
+func (c *TinyLFU) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.lfu = tinylfu.New(c.size, tinyLFUSamples)
+	c.len = 0
+}
+
+// Len returns the approximate number of entries in the cache. TinyLFU does
+// not report some evictions, so the result is capped by the cache size.
+func (c *TinyLFU) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.len > c.size {
+		return c.size
+	}
+	return c.len
+}
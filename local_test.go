@@ -54,3 +54,41 @@ loop:
 		}
 	}
 }
+
+func TestTinyLFU_Reset(t *testing.T) {
+	mycache := cache.NewTinyLFU(1000, time.Minute)
+	mycache.Set("key", []byte("value"))
+
+	mycache.Reset()
+
+	if _, ok := mycache.Get("key"); ok {
+		t.Fatal("key is not removed")
+	}
+}
+
+func TestTinyLFU_SetWithTTL(t *testing.T) {
+	mycache := cache.NewTinyLFU(1000, time.Minute)
+	mycache.SetWithTTL("short", []byte("value"), 100*time.Millisecond)
+	mycache.SetWithTTL("long", []byte("value"), time.Hour)
+
+	time.Sleep(200 * time.Millisecond)
+
+	if _, ok := mycache.Get("short"); ok {
+		t.Fatal("key with short TTL is not expired")
+	}
+	if _, ok := mycache.Get("long"); !ok {
+		t.Fatal("key with long TTL is expired")
+	}
+}
+
+func TestTinyLFU_SetWithTTLRandomized(t *testing.T) {
+	mycache := cache.NewTinyLFU(1000, 100*time.Millisecond)
+	mycache.UseRandomizedTTL(time.Hour)
+	mycache.SetWithTTL("key", []byte("value"), 150*time.Millisecond)
+
+	time.Sleep(200 * time.Millisecond)
+
+	if _, ok := mycache.Get("key"); ok {
+		t.Fatal("key outlives its TTL")
+	}
+}
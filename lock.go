@@ -0,0 +1,141 @@
+package cache
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+var ErrLockTimeout = errors.New("cache: timed out waiting for the lock holder")
+
+// unlockScript deletes the lock only if it is still held by the given token.
+const unlockScript = `
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("del", KEYS[1])
+end
+return 0
+`
+
+// LockOptions configures the distributed lock that Once takes with
+// SET NX PX before calling Item.Do. Other processes wait for the lock
+// holder to cache the value instead of calling Item.Do themselves.
+type LockOptions struct {
+	// TTL is the lock expiration time. It limits how long other processes
+	// wait for the value if the lock holder dies.
+	// Default is 10 seconds.
+	TTL time.Duration
+
+	// WaitTimeout is how long Once waits for the value to appear.
+	// Default is TTL.
+	WaitTimeout time.Duration
+
+	// PollInterval is how often Once checks the value and the lock while waiting.
+	// Default is 50 milliseconds.
+	PollInterval time.Duration
+
+	// ErrorOnTimeout makes Once return ErrLockTimeout when the value does not
+	// appear within WaitTimeout. By default, Once calls Item.Do itself.
+	ErrorOnTimeout bool
+}
+
+func (opt *LockOptions) ttl() time.Duration {
+	if opt.TTL > 0 {
+		return opt.TTL
+	}
+	return 10 * time.Second
+}
+
+func (opt *LockOptions) waitTimeout() time.Duration {
+	if opt.WaitTimeout > 0 {
+		return opt.WaitTimeout
+	}
+	return opt.ttl()
+}
+
+func (opt *LockOptions) pollInterval() time.Duration {
+	if opt.PollInterval > 0 {
+		return opt.PollInterval
+	}
+	return 50 * time.Millisecond
+}
+
+// setLocked caches the item while holding the distributed lock for item.Key
+// or waits for the lock holder to cache it. If the lock holder dies, the lock
+// expires and one of the waiters takes it over.
+func (cd *Cache) setLocked(item *Item) (b []byte, cached bool, err error) {
+	ctx := item.Context()
+	opt := cd.opt.Lock
+	key := lockKey(item.Key)
+	token := randomID()
+
+	deadline := time.Now().Add(opt.waitTimeout())
+	for {
+		locked, err := cd.opt.Redis.SetNX(ctx, key, token, opt.ttl()).Result()
+		if err != nil {
+			// The lock is an optimization, so proceed without it.
+			return cd.setUnlocked(item)
+		}
+
+		if locked {
+			defer cd.unlock(ctx, key, token)
+
+			// The value could have been cached before the lock was acquired.
+			if b, err := cd.getBytes(ctx, item.Key, item.SkipLocalCache); err == nil {
+				return b, true, nil
+			}
+			return cd.setUnlocked(item)
+		}
+
+		if b, err := cd.getBytes(ctx, item.Key, item.SkipLocalCache); err == nil {
+			return b, true, nil
+		}
+
+		if time.Now().After(deadline) {
+			if opt.ErrorOnTimeout {
+				return nil, false, ErrLockTimeout
+			}
+			return cd.setUnlocked(item)
+		}
+
+		if err := sleep(ctx, opt.pollInterval()); err != nil {
+			return nil, false, err
+		}
+	}
+}
+
+func (cd *Cache) setUnlocked(item *Item) ([]byte, bool, error) {
+	b, ok, err := cd.set(item)
+	if ok {
+		return b, false, nil
+	}
+	return nil, false, err
+}
+
+func (cd *Cache) unlock(ctx context.Context, key, token string) {
+	ctx = detachedContext{parent: ctx}
+	_ = cd.opt.Redis.Eval(ctx, unlockScript, []string{key}, token).Err()
+}
+
+func lockKey(key string) string {
+	return key + ":lock"
+}
+
+func randomID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func sleep(ctx context.Context, dur time.Duration) error {
+	t := time.NewTimer(dur)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,106 @@
+package cache_test
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/go-redis/cache/v9"
+)
+
+var _ = Describe("Once with Lock", func() {
+	ctx := context.TODO()
+
+	const key = "mykey"
+
+	var rdb *redis.Ring
+	var caches []*cache.Cache
+
+	newLockedCache := func(opt *cache.LockOptions) *cache.Cache {
+		return cache.New(&cache.Options{
+			Redis:      rdb,
+			LocalCache: cache.NewTinyLFU(1000, time.Minute),
+			Lock:       opt,
+		})
+	}
+
+	BeforeEach(func() {
+		rdb = newRing()
+		caches = nil
+		for i := 0; i < 3; i++ {
+			caches = append(caches, newLockedCache(&cache.LockOptions{
+				TTL:          time.Second,
+				PollInterval: 10 * time.Millisecond,
+			}))
+		}
+	})
+
+	It("calls Do once across processes", func() {
+		var callCount int64
+		perform(30, func(i int) {
+			var got string
+			err := caches[i%len(caches)].Once(&cache.Item{
+				Ctx:   ctx,
+				Key:   key,
+				Value: &got,
+				Do: func(*cache.Item) (interface{}, error) {
+					time.Sleep(100 * time.Millisecond)
+					atomic.AddInt64(&callCount, 1)
+					return "hello", nil
+				},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(got).To(Equal("hello"))
+		})
+		Expect(callCount).To(Equal(int64(1)))
+
+		n, err := rdb.Exists(ctx, key+":lock").Result()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n).To(Equal(int64(0)))
+	})
+
+	Describe("when lock holder is gone", func() {
+		BeforeEach(func() {
+			err := rdb.Set(ctx, key+":lock", "token", time.Minute).Err()
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("calls Do after WaitTimeout", func() {
+			mycache := newLockedCache(&cache.LockOptions{
+				WaitTimeout: 100 * time.Millisecond,
+			})
+
+			var got string
+			err := mycache.Once(&cache.Item{
+				Ctx:   ctx,
+				Key:   key,
+				Value: &got,
+				Do: func(*cache.Item) (interface{}, error) {
+					return "hello", nil
+				},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(got).To(Equal("hello"))
+		})
+
+		It("returns ErrLockTimeout", func() {
+			mycache := newLockedCache(&cache.LockOptions{
+				WaitTimeout:    100 * time.Millisecond,
+				ErrorOnTimeout: true,
+			})
+
+			err := mycache.Once(&cache.Item{
+				Ctx: ctx,
+				Key: key,
+				Do: func(*cache.Item) (interface{}, error) {
+					return "hello", nil
+				},
+			})
+			Expect(err).To(Equal(cache.ErrLockTimeout))
+		})
+	})
+})
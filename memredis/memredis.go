@@ -0,0 +1,560 @@
+// Package memredis implements an in-memory stand-in for Redis that can be
+// used as cache.Options.Redis in tests and in deployments without a Redis
+// server.
+//
+// Commands are executed by a go-redis hook, so the returned client supports
+// pipelines and the usual typed commands. Only the commands used to store
+// values are implemented: GET, GETEX, SET with EX, PX, EXAT, PXAT, NX, XX
+// and KEEPTTL options, SETNX, DEL, EXISTS, INCR, EXPIRE, PEXPIRE, TTL, PTTL
+// and PUBLISH. Other commands, including EVAL, fail with an error reply, so
+// cache features that rely on scripts or Pub/Sub, e.g. Options.Lock and
+// Item.Tags, require a real Redis server.
+package memredis
+
+import (
+	"context"
+	"encoding"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var errNoNetwork = errors.New("memredis: the client does not use the network")
+
+// Server holds the data of the clients returned by NewClient.
+// It is safe for concurrent use.
+type Server struct {
+	mu   sync.Mutex
+	data map[string]entry
+
+	now    func() time.Time
+	offset time.Duration
+
+	latency time.Duration
+	fault   func(cmd redis.Cmder) error
+}
+
+type entry struct {
+	value    string
+	expireAt time.Time
+}
+
+func NewServer() *Server {
+	return &Server{
+		data: make(map[string]entry),
+		now:  time.Now,
+	}
+}
+
+// NewClient returns a client that executes commands on the server.
+// The client never opens network connections.
+func (s *Server) NewClient() *redis.Client {
+	rdb := redis.NewClient(&redis.Options{
+		Addr: "memredis",
+		Dialer: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return nil, errNoNetwork
+		},
+	})
+	rdb.AddHook(hook{s: s})
+	return rdb
+}
+
+// SetNow sets the function that returns the current time of the server,
+// which is used to expire keys. The default is time.Now.
+func (s *Server) SetNow(now func() time.Time) {
+	s.mu.Lock()
+	s.now = now
+	s.offset = 0
+	s.mu.Unlock()
+}
+
+// Advance moves the clock of the server forward, expiring the keys
+// whose TTL has passed.
+func (s *Server) Advance(d time.Duration) {
+	s.mu.Lock()
+	s.offset += d
+	s.mu.Unlock()
+}
+
+// SetLatency delays every command and pipeline by d.
+func (s *Server) SetLatency(d time.Duration) {
+	s.mu.Lock()
+	s.latency = d
+	s.mu.Unlock()
+}
+
+// SetFault sets the function that is called before every command, including
+// the commands in pipelines. If it returns an error, the command fails
+// with that error and is not executed. Pass nil to remove the fault.
+func (s *Server) SetFault(fault func(cmd redis.Cmder) error) {
+	s.mu.Lock()
+	s.fault = fault
+	s.mu.Unlock()
+}
+
+// FlushAll deletes all keys.
+func (s *Server) FlushAll() {
+	s.mu.Lock()
+	s.data = make(map[string]entry)
+	s.mu.Unlock()
+}
+
+// Len returns the number of keys that have not expired.
+func (s *Server) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.clock()
+	n := 0
+	for _, e := range s.data {
+		if !e.expired(now) {
+			n++
+		}
+	}
+	return n
+}
+
+func (s *Server) clock() time.Time {
+	return s.now().Add(s.offset)
+}
+
+func (s *Server) process(ctx context.Context, cmds []redis.Cmder) error {
+	s.mu.Lock()
+	latency, fault := s.latency, s.fault
+	s.mu.Unlock()
+
+	err := ctx.Err()
+	if err == nil && latency > 0 {
+		err = sleep(ctx, latency)
+	}
+	if err != nil {
+		for _, cmd := range cmds {
+			cmd.SetErr(err)
+		}
+		return err
+	}
+
+	// The fault is called without holding the lock, so it can use the server.
+	var faults []error
+	if fault != nil {
+		faults = make([]error, len(cmds))
+		for i, cmd := range cmds {
+			faults[i] = fault(cmd)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var firstErr error
+	for i, cmd := range cmds {
+		var err error
+		if faults != nil && faults[i] != nil {
+			err = faults[i]
+			cmd.SetErr(err)
+		} else {
+			err = s.exec(cmd)
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// exec executes the command and stores the result in it.
+func (s *Server) exec(cmd redis.Cmder) error {
+	val, err := s.call(strings.ToLower(cmd.Name()), cmd.Args()[1:])
+	if err == redis.Nil {
+		// SET with NX or XX replies with nil if the key was not set.
+		if cmd, ok := cmd.(*redis.BoolCmd); ok {
+			cmd.SetVal(false)
+			return nil
+		}
+	}
+	if err != nil {
+		cmd.SetErr(err)
+		return err
+	}
+	return setVal(cmd, val)
+}
+
+func (s *Server) call(name string, args []interface{}) (interface{}, error) {
+	switch name {
+	case "ping":
+		return "PONG", nil
+	case "multi", "flushdb", "flushall":
+		if name != "multi" {
+			s.data = make(map[string]entry)
+		}
+		return "OK", nil
+	case "exec":
+		return []interface{}(nil), nil
+	case "publish":
+		return int64(0), nil
+	case "get":
+		if len(args) != 1 {
+			return nil, wrongArgs(name)
+		}
+		e, ok := s.get(str(args[0]))
+		if !ok {
+			return nil, redis.Nil
+		}
+		return e.value, nil
+	case "getex":
+		return s.getex(args)
+	case "set":
+		return s.set(args)
+	case "setnx":
+		if len(args) != 2 {
+			return nil, wrongArgs(name)
+		}
+		if _, ok := s.get(str(args[0])); ok {
+			return int64(0), nil
+		}
+		s.data[str(args[0])] = entry{value: str(args[1])}
+		return int64(1), nil
+	case "del", "exists":
+		var n int64
+		for _, arg := range args {
+			key := str(arg)
+			if _, ok := s.get(key); ok {
+				n++
+				if name == "del" {
+					delete(s.data, key)
+				}
+			}
+		}
+		return n, nil
+	case "incr":
+		if len(args) != 1 {
+			return nil, wrongArgs(name)
+		}
+		return s.incr(str(args[0]))
+	case "expire", "pexpire":
+		if len(args) != 2 {
+			return nil, wrongArgs(name)
+		}
+		n, err := integer(args[1])
+		if err != nil {
+			return nil, err
+		}
+		unit := time.Second
+		if name == "pexpire" {
+			unit = time.Millisecond
+		}
+		return s.expire(str(args[0]), time.Duration(n)*unit), nil
+	case "ttl", "pttl":
+		if len(args) != 1 {
+			return nil, wrongArgs(name)
+		}
+		return s.ttl(str(args[0]), name == "pttl"), nil
+	default:
+		return nil, replyError(fmt.Sprintf("ERR unknown command '%s'", name))
+	}
+}
+
+// get returns the entry deleting it if it has expired.
+func (s *Server) get(key string) (entry, bool) {
+	e, ok := s.data[key]
+	if !ok {
+		return entry{}, false
+	}
+	if e.expired(s.clock()) {
+		delete(s.data, key)
+		return entry{}, false
+	}
+	return e, true
+}
+
+func (s *Server) getex(args []interface{}) (interface{}, error) {
+	if len(args) < 1 {
+		return nil, wrongArgs("getex")
+	}
+	key := str(args[0])
+
+	e, ok := s.get(key)
+	if !ok {
+		return nil, redis.Nil
+	}
+
+	switch len(args) {
+	case 1:
+	case 2:
+		if strings.ToLower(str(args[1])) != "persist" {
+			return nil, replyError("ERR syntax error")
+		}
+		e.expireAt = time.Time{}
+	case 3:
+		expireAt, err := s.expireAt(strings.ToLower(str(args[1])), args[2])
+		if err != nil {
+			return nil, err
+		}
+		e.expireAt = expireAt
+	default:
+		return nil, replyError("ERR syntax error")
+	}
+
+	s.data[key] = e
+	return e.value, nil
+}
+
+// expireAt parses the EX, PX, EXAT and PXAT options.
+func (s *Server) expireAt(opt string, arg interface{}) (time.Time, error) {
+	n, err := integer(arg)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if n <= 0 {
+		return time.Time{}, replyError("ERR invalid expire time")
+	}
+
+	switch opt {
+	case "ex":
+		return s.clock().Add(time.Duration(n) * time.Second), nil
+	case "px":
+		return s.clock().Add(time.Duration(n) * time.Millisecond), nil
+	case "exat":
+		return time.Unix(n, 0), nil
+	case "pxat":
+		return time.Unix(0, n*int64(time.Millisecond)), nil
+	default:
+		return time.Time{}, replyError("ERR syntax error")
+	}
+}
+
+func (s *Server) set(args []interface{}) (interface{}, error) {
+	if len(args) < 2 {
+		return nil, wrongArgs("set")
+	}
+	key, value := str(args[0]), str(args[1])
+
+	var expireAt time.Time
+	var nx, xx, keepTTL bool
+	for i := 2; i < len(args); i++ {
+		switch opt := strings.ToLower(str(args[i])); opt {
+		case "nx":
+			nx = true
+		case "xx":
+			xx = true
+		case "keepttl":
+			keepTTL = true
+		case "ex", "px", "exat", "pxat":
+			i++
+			if i == len(args) {
+				return nil, replyError("ERR syntax error")
+			}
+			var err error
+			expireAt, err = s.expireAt(opt, args[i])
+			if err != nil {
+				return nil, err
+			}
+		default:
+			return nil, replyError("ERR syntax error")
+		}
+	}
+
+	old, exists := s.get(key)
+	if (nx && exists) || (xx && !exists) {
+		return nil, redis.Nil
+	}
+	if keepTTL && exists {
+		expireAt = old.expireAt
+	}
+
+	s.data[key] = entry{value: value, expireAt: expireAt}
+	return "OK", nil
+}
+
+func (s *Server) incr(key string) (interface{}, error) {
+	e, _ := s.get(key)
+
+	var n int64
+	if e.value != "" {
+		var err error
+		n, err = strconv.ParseInt(e.value, 10, 64)
+		if err != nil {
+			return nil, replyError("ERR value is not an integer or out of range")
+		}
+	}
+	n++
+
+	e.value = strconv.FormatInt(n, 10)
+	s.data[key] = e
+	return n, nil
+}
+
+func (s *Server) expire(key string, ttl time.Duration) bool {
+	e, ok := s.get(key)
+	if !ok {
+		return false
+	}
+	if ttl <= 0 {
+		delete(s.data, key)
+		return true
+	}
+	e.expireAt = s.clock().Add(ttl)
+	s.data[key] = e
+	return true
+}
+
+func (s *Server) ttl(key string, precise bool) time.Duration {
+	e, ok := s.get(key)
+	if !ok {
+		return -2
+	}
+	if e.expireAt.IsZero() {
+		return -1
+	}
+
+	ttl := e.expireAt.Sub(s.clock())
+	if precise {
+		return ttl.Truncate(time.Millisecond)
+	}
+	return ttl.Round(time.Second)
+}
+
+func (e entry) expired(now time.Time) bool {
+	return !e.expireAt.IsZero() && !now.Before(e.expireAt)
+}
+
+//------------------------------------------------------------------------------
+
+type hook struct {
+	s *Server
+}
+
+var _ redis.Hook = hook{}
+
+func (h hook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h hook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		return h.s.process(ctx, []redis.Cmder{cmd})
+	}
+}
+
+func (h hook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		return h.s.process(ctx, cmds)
+	}
+}
+
+// replyError is an error reply. It implements redis.Error, so it is
+// treated like the errors returned by a Redis server.
+type replyError string
+
+func (e replyError) Error() string { return string(e) }
+
+func (replyError) RedisError() {}
+
+func wrongArgs(name string) error {
+	return replyError(fmt.Sprintf("ERR wrong number of arguments for '%s' command", name))
+}
+
+func setVal(cmd redis.Cmder, val interface{}) error {
+	switch cmd := cmd.(type) {
+	case *redis.Cmd:
+		cmd.SetVal(val)
+		return nil
+	case *redis.StringCmd:
+		if val, ok := val.(string); ok {
+			cmd.SetVal(val)
+			return nil
+		}
+	case *redis.StatusCmd:
+		if val, ok := val.(string); ok {
+			cmd.SetVal(val)
+			return nil
+		}
+	case *redis.IntCmd:
+		if val, ok := val.(int64); ok {
+			cmd.SetVal(val)
+			return nil
+		}
+	case *redis.BoolCmd:
+		switch val := val.(type) {
+		case bool:
+			cmd.SetVal(val)
+			return nil
+		case int64:
+			cmd.SetVal(val == 1)
+			return nil
+		case string:
+			cmd.SetVal(val == "OK")
+			return nil
+		}
+	case *redis.DurationCmd:
+		if val, ok := val.(time.Duration); ok {
+			cmd.SetVal(val)
+			return nil
+		}
+	case *redis.SliceCmd:
+		if val, ok := val.([]interface{}); ok {
+			cmd.SetVal(val)
+			return nil
+		}
+	}
+
+	err := fmt.Errorf("memredis: can't store %T reply in %T", val, cmd)
+	cmd.SetErr(err)
+	return err
+}
+
+// str converts the argument to a string like go-redis does when it writes
+// the command.
+func str(arg interface{}) string {
+	switch arg := arg.(type) {
+	case string:
+		return arg
+	case []byte:
+		return string(arg)
+	case nil:
+		return ""
+	case bool:
+		if arg {
+			return "1"
+		}
+		return "0"
+	case float64:
+		return strconv.FormatFloat(arg, 'f', -1, 64)
+	case time.Time:
+		return arg.Format(time.RFC3339Nano)
+	case encoding.BinaryMarshaler:
+		b, err := arg.MarshalBinary()
+		if err != nil {
+			return ""
+		}
+		return string(b)
+	default:
+		return fmt.Sprint(arg)
+	}
+}
+
+func integer(arg interface{}) (int64, error) {
+	n, err := strconv.ParseInt(str(arg), 10, 64)
+	if err != nil {
+		return 0, replyError("ERR value is not an integer or out of range")
+	}
+	return n, nil
+}
+
+func sleep(ctx context.Context, dur time.Duration) error {
+	t := time.NewTimer(dur)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
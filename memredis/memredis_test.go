@@ -0,0 +1,122 @@
+package memredis_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/go-redis/cache/v9"
+	"github.com/go-redis/cache/v9/memredis"
+)
+
+func TestServer_Expiration(t *testing.T) {
+	ctx := context.Background()
+	srv := memredis.NewServer()
+	rdb := srv.NewClient()
+
+	now := time.Now()
+	srv.SetNow(func() time.Time { return now })
+
+	if err := rdb.Set(ctx, "key", "value", time.Minute).Err(); err != nil {
+		t.Fatal(err)
+	}
+	if ok := rdb.SetNX(ctx, "key", "other", time.Minute).Val(); ok {
+		t.Fatal("SetNX overwrote the key")
+	}
+	if ok := rdb.SetXX(ctx, "missing", "value", time.Minute).Val(); ok {
+		t.Fatal("SetXX created the key")
+	}
+
+	srv.Advance(30 * time.Second)
+	if ttl := rdb.PTTL(ctx, "key").Val(); ttl != 30*time.Second {
+		t.Fatalf("got TTL %s, wanted 30s", ttl)
+	}
+	if err := rdb.GetEx(ctx, "key", time.Minute).Err(); err != nil {
+		t.Fatal(err)
+	}
+	if ttl := rdb.TTL(ctx, "key").Val(); ttl != time.Minute {
+		t.Fatalf("got TTL %s, wanted 1m", ttl)
+	}
+
+	srv.Advance(time.Minute)
+	if err := rdb.Get(ctx, "key").Err(); err != redis.Nil {
+		t.Fatalf("got %v, wanted redis.Nil", err)
+	}
+	if n := srv.Len(); n != 0 {
+		t.Fatalf("got %d keys, wanted 0", n)
+	}
+}
+
+func TestServer_Faults(t *testing.T) {
+	ctx := context.Background()
+	srv := memredis.NewServer()
+	rdb := srv.NewClient()
+
+	errDown := errors.New("shard is down")
+	srv.SetFault(func(cmd redis.Cmder) error {
+		if cmd.Args()[1] == "bad" {
+			return errDown
+		}
+		return nil
+	})
+
+	pipe := rdb.Pipeline()
+	good := pipe.Set(ctx, "good", "value", 0)
+	bad := pipe.Set(ctx, "bad", "value", 0)
+	if _, err := pipe.Exec(ctx); err != errDown {
+		t.Fatalf("got %v, wanted %v", err, errDown)
+	}
+	if good.Err() != nil || bad.Err() != errDown {
+		t.Fatalf("got %v and %v", good.Err(), bad.Err())
+	}
+
+	srv.SetFault(nil)
+	srv.SetLatency(time.Second)
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := rdb.Get(ctx, "good").Err(); err != context.DeadlineExceeded {
+		t.Fatalf("got %v, wanted %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestServer_Cache(t *testing.T) {
+	ctx := context.Background()
+	srv := memredis.NewServer()
+	mycache := cache.New(&cache.Options{
+		Redis: srv.NewClient(),
+	})
+
+	var calls int
+	once := func() string {
+		var s string
+		err := mycache.Once(&cache.Item{
+			Ctx:   ctx,
+			Key:   "key",
+			Value: &s,
+			TTL:   time.Minute,
+			Do: func(*cache.Item) (interface{}, error) {
+				calls++
+				return "value", nil
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	once()
+	if s := once(); s != "value" || calls != 1 {
+		t.Fatalf("got %q after %d calls", s, calls)
+	}
+
+	srv.Advance(time.Minute)
+	once()
+	if calls != 2 {
+		t.Fatalf("got %d calls, wanted 2", calls)
+	}
+}
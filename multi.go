@@ -0,0 +1,507 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// GetMulti gets the values for the given keys and stores them in dst,
+// which must be a non-nil map with string keys, e.g. map[string]*Object.
+// Keys that are missing in the cache or cached as not found (see
+// Item.NegativeTTL) are not added to dst.
+//
+// LocalCache is consulted first and only the remaining keys are fetched
+// from Redis using a single pipeline, which works with Ring and Cluster
+// unlike MGET.
+func (cd *Cache) GetMulti(ctx context.Context, keys []string, dst interface{}) error {
+	m, err := mapValue(dst)
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	prefix := cd.keyPrefix(ctx)
+	prefixed := withPrefix(prefix, keys)
+
+	var found map[string][]byte
+	event := &Event{Op: OpGetMulti, Keys: prefixed}
+	err = cd.withHooks(ctx, event, func(ctx context.Context) error {
+		var err error
+		found, err = cd.getMultiBytes(ctx, prefixed, 0)
+		event.Hits, event.Size = len(found), totalSize(found)
+		return err
+	})
+	cd.recordMultiGroupStats(keys, prefixed, found, start)
+	if err != nil {
+		return err
+	}
+	return cd.unmarshalMap(trimPrefix(prefix, found), m)
+}
+
+func totalSize(m map[string][]byte) int {
+	var size int
+	for _, b := range m {
+		size += len(b)
+	}
+	return size
+}
+
+func mapValue(dst interface{}) (reflect.Value, error) {
+	m := reflect.ValueOf(dst)
+	if m.Kind() != reflect.Map || m.Type().Key().Kind() != reflect.String {
+		return reflect.Value{}, fmt.Errorf("cache: dst must be a map with string keys, got %T", dst)
+	}
+	if m.IsNil() {
+		return reflect.Value{}, fmt.Errorf("cache: dst must be a non-nil map, got nil %T", dst)
+	}
+	return m, nil
+}
+
+func (cd *Cache) unmarshalMap(found map[string][]byte, m reflect.Value) error {
+	typ := m.Type()
+	for key, b := range found {
+		if isNotFound(b) {
+			continue
+		}
+		elem := reflect.New(typ.Elem())
+		if err := cd.unmarshalValue(b, elem.Interface()); err != nil {
+			return err
+		}
+		m.SetMapIndex(reflect.ValueOf(key).Convert(typ.Key()), elem.Elem())
+	}
+	return nil
+}
+
+// getMultiBytes gets the values from the LocalCache and Redis. The values
+// read from Redis are stored in the LocalCache for localTTL, or the LocalCache
+// default if it is zero.
+func (cd *Cache) getMultiBytes(
+	ctx context.Context, keys []string, localTTL time.Duration,
+) (map[string][]byte, error) {
+	found := make(map[string][]byte, len(keys))
+
+	missing := keys
+	if cd.opt.LocalCache != nil {
+		missing = make([]string, 0, len(keys))
+		for _, key := range keys {
+			if b, ok := cd.getLocal(key); ok {
+				found[key] = b
+			} else {
+				missing = append(missing, key)
+			}
+		}
+	}
+
+	if cd.opt.Redis == nil {
+		if cd.opt.LocalCache == nil {
+			return nil, errRedisLocalCacheNil
+		}
+		return found, nil
+	}
+	if len(missing) == 0 {
+		return found, nil
+	}
+
+	if !cd.breaker.allow() {
+		cd.incr(&cd.stats.misses, uint64(len(missing)))
+		return found, nil
+	}
+
+	epoch := cd.localEpoch()
+	rdb, cacheLocally := cd.tracker.reader(cd.opt.Redis)
+	pipe := rdb.Pipeline()
+	cmds := make([]*redis.StringCmd, len(missing))
+	for i, key := range missing {
+		cmds[i] = pipe.Get(ctx, key)
+	}
+	_, err := pipe.Exec(ctx)
+	cd.redisDone(err)
+
+	for i, cmd := range cmds {
+		b, err := cmd.Bytes()
+		if err != nil {
+			cd.incr(&cd.stats.misses, 1)
+			if err == redis.Nil {
+				cd.incr(&cd.stats.redisMisses, 1)
+				continue
+			}
+			return nil, err
+		}
+
+		cd.incr(&cd.stats.redisHits, 1)
+		cd.incr(&cd.stats.bytesRead, uint64(len(b)))
+
+		key := missing[i]
+		found[key] = b
+		if cd.opt.LocalCache != nil && cacheLocally {
+			cd.setLocalRead(key, b, localTTL, epoch)
+		}
+	}
+
+	return found, nil
+}
+
+// SetMulti caches the items writing them to Redis using a single pipeline.
+// The context of the first item is used to execute the pipeline.
+func (cd *Cache) SetMulti(items []*Item) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	prefixed := make([]*Item, len(items))
+	keys := make([]string, len(items))
+	for i, item := range items {
+		prefixed[i] = cd.itemWithKey(item)
+		keys[i] = prefixed[i].Key
+	}
+
+	event := &Event{Op: OpSetMulti, Keys: keys}
+	return cd.withHooks(items[0].Context(), event, func(ctx context.Context) error {
+		bs, err := cd.setMulti(ctx, prefixed)
+		for _, b := range bs {
+			event.Size += len(b)
+		}
+		return err
+	})
+}
+
+// setMulti executes the pipeline with ctx.
+func (cd *Cache) setMulti(ctx context.Context, items []*Item) ([][]byte, error) {
+	if len(items) == 0 {
+		return nil, nil
+	}
+
+	var pipe redis.Pipeliner
+	if cd.opt.Redis != nil {
+		pipe = cd.opt.Redis.Pipeline()
+	}
+
+	bs := make([][]byte, len(items))
+	cmds := make([]redis.Cmder, len(items))
+	var written int
+	for i, item := range items {
+		if err := cd.checkTags(item.Tags); err != nil {
+			return nil, err
+		}
+		b, err := cd.itemBytes(item)
+		if err != nil {
+			return nil, err
+		}
+		bs[i] = b
+
+		useLocal := cd.opt.LocalCache != nil && !item.SkipLocalCache
+		ttl := item.redisTTL()
+		if pipe == nil || ttl == 0 {
+			if useLocal {
+				cd.setLocalIf(item, b)
+			}
+			continue
+		}
+
+		// With SetNX and SetXX the LocalCache is updated after Redis
+		// accepts the write.
+		if useLocal && !item.SetNX && !item.SetXX {
+			cd.setLocal(item.Key, b, item.localTTL())
+		}
+		cmds[i] = setItem(pipe, item, b, ttl)
+		cd.addTags(pipe, item, ttl)
+		written += len(b)
+	}
+
+	if pipe == nil {
+		if cd.opt.LocalCache == nil {
+			return bs, errRedisLocalCacheNil
+		}
+		return bs, nil
+	}
+	if pipe.Len() == 0 {
+		return bs, nil
+	}
+	if !cd.breaker.allow() {
+		return bs, ErrCircuitOpen
+	}
+
+	if cd.invalidator != nil {
+		keys := make([]string, len(items))
+		for i, item := range items {
+			keys[i] = item.Key
+		}
+		cd.publish(ctx, pipe, keys...)
+	}
+
+	_, err := pipe.Exec(ctx)
+	cd.redisDone(err)
+
+	for i, item := range items {
+		// SET NX and SET XX report whether the key was set.
+		cmd, ok := cmds[i].(*redis.BoolCmd)
+		if !ok {
+			continue
+		}
+		if !cmd.Val() {
+			written -= len(bs[i])
+			continue
+		}
+		if cd.opt.LocalCache != nil && !item.SkipLocalCache {
+			cd.setLocal(item.Key, bs[i], item.localTTL())
+		}
+	}
+
+	if err == nil {
+		cd.incr(&cd.stats.bytesWritten, uint64(written))
+	}
+	return bs, err
+}
+
+// DeleteMulti deletes the given keys from LocalCache and Redis.
+func (cd *Cache) DeleteMulti(ctx context.Context, keys ...string) error {
+	keys = withPrefix(cd.keyPrefix(ctx), keys)
+	event := &Event{Op: OpDeleteMulti, Keys: keys}
+	return cd.withHooks(ctx, event, func(ctx context.Context) error {
+		return cd.deleteMulti(ctx, keys...)
+	})
+}
+
+func (cd *Cache) deleteMulti(ctx context.Context, keys ...string) error {
+	if cd.opt.LocalCache != nil {
+		for _, key := range keys {
+			cd.opt.LocalCache.Del(key)
+		}
+	}
+
+	if cd.opt.Redis == nil {
+		if cd.opt.LocalCache == nil {
+			return errRedisLocalCacheNil
+		}
+		return nil
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+
+	if !cd.breaker.allow() {
+		return ErrCircuitOpen
+	}
+
+	// Keys are deleted one by one so Ring and Cluster can route them.
+	pipe := cd.opt.Redis.Pipeline()
+	for _, key := range keys {
+		pipe.Del(ctx, key)
+	}
+	cd.publish(ctx, pipe, keys...)
+	_, err := pipe.Exec(ctx)
+	cd.redisDone(err)
+	return err
+}
+
+type onceManyCall struct {
+	done chan struct{}
+	b    []byte
+	ok   bool
+	err  error
+}
+
+// OnceMany gets the values for the given keys from the cache and stores them
+// in dst like GetMulti does. The keys that are missing in the cache are
+// passed to the loader, which is called at most once; the loaded values are
+// cached with the given ttl and stored in dst. Keys that the loader did not
+// return are not added to dst.
+//
+// Like Once, OnceMany makes sure that only one load is in-flight for a key
+// at a time, even across overlapping batches: keys that are already being
+// loaded by another call are not passed to the loader and the results of
+// that call are used instead.
+func (cd *Cache) OnceMany(
+	ctx context.Context,
+	keys []string,
+	ttl time.Duration,
+	loader func(missingKeys []string) (map[string]interface{}, error),
+	dst interface{},
+) error {
+	m, err := mapValue(dst)
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	prefix := cd.keyPrefix(ctx)
+	prefixed := withPrefix(prefix, keys)
+	if prefix != "" {
+		loader = prefixedLoader(prefix, loader)
+	}
+
+	var cached, loaded map[string][]byte
+	event := &Event{Op: OpOnceMany, Keys: prefixed}
+	err = cd.withHooks(ctx, event, func(ctx context.Context) error {
+		var err error
+		cached, loaded, err = cd.onceMany(ctx, prefixed, ttl, loader)
+		event.Hits, event.Size = len(cached), totalSize(cached)+totalSize(loaded)
+		return err
+	})
+	cd.recordMultiGroupStats(keys, prefixed, cached, start)
+	if err != nil {
+		return err
+	}
+
+	if err := cd.unmarshalMap(trimPrefix(prefix, cached), m); err != nil {
+		return err
+	}
+	return cd.unmarshalMap(trimPrefix(prefix, loaded), m)
+}
+
+// onceMany returns the values found in the cache and the values loaded
+// by this or a concurrent call.
+func (cd *Cache) onceMany(
+	ctx context.Context,
+	keys []string,
+	ttl time.Duration,
+	loader func(missingKeys []string) (map[string]interface{}, error),
+) (cached, loaded map[string][]byte, err error) {
+	item := &Item{TTL: ttl}
+	cached, err = cd.getMultiBytes(ctx, keys, item.localTTL())
+	if err != nil && err != errRedisLocalCacheNil {
+		return nil, nil, err
+	}
+
+	missingKeys, owned, waiting := cd.claimOnceMany(keys, cached)
+	cd.incr(&cd.stats.singleflightDedups, uint64(len(waiting)))
+	loaded = make(map[string][]byte, len(owned)+len(waiting))
+
+	if len(missingKeys) > 0 {
+		if err := cd.loadOnceMany(ctx, missingKeys, owned, ttl, loader); err != nil {
+			return cached, nil, err
+		}
+		for key, c := range owned {
+			if c.ok {
+				loaded[key] = c.b
+			}
+		}
+	}
+
+	for key, c := range waiting {
+		select {
+		case <-c.done:
+		case <-ctx.Done():
+			return cached, nil, ctx.Err()
+		}
+		if c.err != nil {
+			return cached, nil, c.err
+		}
+		if c.ok {
+			loaded[key] = c.b
+		}
+	}
+
+	return cached, loaded, nil
+}
+
+// claimOnceMany registers in-flight calls for the keys that are not found
+// and are not being loaded yet. Keys already being loaded are returned
+// separately so the caller can wait for them.
+func (cd *Cache) claimOnceMany(
+	keys []string, found map[string][]byte,
+) (missingKeys []string, owned, waiting map[string]*onceManyCall) {
+	cd.onceManyMu.Lock()
+	defer cd.onceManyMu.Unlock()
+
+	if cd.onceManyCalls == nil {
+		cd.onceManyCalls = make(map[string]*onceManyCall)
+	}
+
+	for _, key := range keys {
+		if _, ok := found[key]; ok {
+			continue
+		}
+		if _, ok := owned[key]; ok {
+			continue
+		}
+
+		if c, ok := cd.onceManyCalls[key]; ok {
+			if waiting == nil {
+				waiting = make(map[string]*onceManyCall)
+			}
+			waiting[key] = c
+			continue
+		}
+
+		c := &onceManyCall{done: make(chan struct{})}
+		cd.onceManyCalls[key] = c
+		if owned == nil {
+			owned = make(map[string]*onceManyCall)
+		}
+		owned[key] = c
+		missingKeys = append(missingKeys, key)
+	}
+
+	return missingKeys, owned, waiting
+}
+
+// loadOnceMany loads and caches the missing keys and then releases
+// the in-flight calls waking up the waiters.
+func (cd *Cache) loadOnceMany(
+	ctx context.Context,
+	missingKeys []string,
+	calls map[string]*onceManyCall,
+	ttl time.Duration,
+	loader func(missingKeys []string) (map[string]interface{}, error),
+) (err error) {
+	defer func() {
+		cd.onceManyMu.Lock()
+		for key, c := range calls {
+			if err != nil {
+				c.err = err
+			}
+			delete(cd.onceManyCalls, key)
+		}
+		cd.onceManyMu.Unlock()
+
+		for _, c := range calls {
+			close(c.done)
+		}
+	}()
+
+	cd.incr(&cd.stats.loaderCalls, 1)
+	var values map[string]interface{}
+	event := &Event{Op: OpDo, Keys: missingKeys, Tier: TierLoader}
+	err = cd.withHooks(ctx, event, func(context.Context) error {
+		var err error
+		values, err = loader(missingKeys)
+		return err
+	})
+	if err != nil {
+		cd.incr(&cd.stats.loaderErrors, 1)
+		return err
+	}
+
+	items := make([]*Item, 0, len(values))
+	for _, key := range missingKeys {
+		value, ok := values[key]
+		if !ok {
+			continue
+		}
+		items = append(items, &Item{
+			Ctx:   ctx,
+			Key:   key,
+			Value: value,
+			TTL:   ttl,
+		})
+	}
+
+	bs, err := cd.setMulti(ctx, items)
+	if bs == nil {
+		return err
+	}
+	for i, item := range items {
+		c := calls[item.Key]
+		c.b = bs[i]
+		c.ok = true
+	}
+	if err == errRedisLocalCacheNil || err == ErrCircuitOpen {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,251 @@
+package cache
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// namespaceGenerationTTL is how long the generation of a namespace is
+// cached before it is read from Redis again.
+const namespaceGenerationTTL = time.Second
+
+type namespace struct {
+	name   string
+	genKey string
+
+	mu       sync.Mutex
+	gen      int64
+	loadedAt time.Time
+	// loading is closed when the generation being read from Redis
+	// is stored, or nil if it is not being read.
+	loading chan struct{}
+}
+
+// WithNamespace returns a view of the cache that stores keys with the prefix
+// Options.Prefix + name + ":v<generation>:" in Redis and the LocalCache.
+// The view shares the clients, stats and hooks with cd. Namespaces are not
+// nested: the namespace of cd, if any, is not included in the prefix.
+//
+// The generation is stored in Redis and is incremented by
+// InvalidateNamespace. Each Cache reads it at most once per second,
+// so other instances see the new generation within a second.
+func (cd *Cache) WithNamespace(name string) *Cache {
+	return &Cache{
+		core: cd.core,
+		ns:   cd.namespace(name),
+	}
+}
+
+// InvalidateNamespace invalidates all keys in the namespace by incrementing
+// its generation. The keys of the previous generation are no longer read
+// and are removed when they expire.
+func (cd *Cache) InvalidateNamespace(ctx context.Context, name string) error {
+	ns := cd.namespace(name)
+
+	if cd.opt.Redis == nil {
+		if cd.opt.LocalCache == nil {
+			return errRedisLocalCacheNil
+		}
+		ns.mu.Lock()
+		ns.gen++
+		ns.mu.Unlock()
+		return nil
+	}
+
+	if !cd.breaker.allow() {
+		return ErrCircuitOpen
+	}
+
+	gen, err := cd.opt.Redis.Incr(ctx, ns.genKey).Result()
+	cd.redisDone(err)
+	if err != nil {
+		return err
+	}
+
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+
+	// Concurrent calls may return in any order.
+	if gen > ns.gen {
+		ns.gen = gen
+	}
+	ns.loadedAt = time.Now()
+	return nil
+}
+
+func (cd *Cache) namespace(name string) *namespace {
+	cd.namespacesMu.Lock()
+	defer cd.namespacesMu.Unlock()
+
+	if ns, ok := cd.namespaces[name]; ok {
+		return ns
+	}
+
+	if cd.namespaces == nil {
+		cd.namespaces = make(map[string]*namespace)
+	}
+	ns := &namespace{
+		name:   name,
+		genKey: cd.opt.Prefix + name + ":gen",
+	}
+	cd.namespaces[name] = ns
+	return ns
+}
+
+// generation returns the current generation of the namespace.
+// If Redis is unavailable, the last known generation is used.
+//
+// Only one goroutine reads the generation from Redis at a time. The others
+// use the last known generation meanwhile, or wait for it if it has never
+// been read.
+func (cd *Cache) generation(ctx context.Context, ns *namespace) int64 {
+	ns.mu.Lock()
+
+	if cd.opt.Redis == nil || time.Since(ns.loadedAt) < namespaceGenerationTTL {
+		gen := ns.gen
+		ns.mu.Unlock()
+		return gen
+	}
+
+	if loading := ns.loading; loading != nil {
+		if !ns.loadedAt.IsZero() {
+			gen := ns.gen
+			ns.mu.Unlock()
+			return gen
+		}
+		ns.mu.Unlock()
+
+		select {
+		case <-loading:
+		case <-ctx.Done():
+		}
+
+		ns.mu.Lock()
+		defer ns.mu.Unlock()
+		return ns.gen
+	}
+
+	if !cd.breaker.allow() {
+		gen := ns.gen
+		ns.mu.Unlock()
+		return gen
+	}
+
+	loading := make(chan struct{})
+	ns.loading = loading
+	loadedAt := ns.loadedAt
+	ns.mu.Unlock()
+
+	cmd := cd.opt.Redis.Get(ctx, ns.genKey)
+	cd.redisDone(cmd.Err())
+
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+
+	// InvalidateNamespace may have stored a newer generation meanwhile.
+	if ns.loadedAt.Equal(loadedAt) {
+		if gen, err := cmd.Int64(); err == nil {
+			ns.gen = gen
+		} else if err == redis.Nil {
+			ns.gen = 0
+		}
+		ns.loadedAt = time.Now()
+	}
+	ns.loading = nil
+	close(loading)
+	return ns.gen
+}
+
+// keyPrefix returns the prefix of the keys stored in Redis and the LocalCache.
+func (cd *Cache) keyPrefix(ctx context.Context) string {
+	if cd.ns == nil {
+		return cd.opt.Prefix
+	}
+	gen := cd.generation(ctx, cd.ns)
+	return cd.opt.Prefix + cd.ns.name + ":v" + strconv.FormatInt(gen, 10) + ":"
+}
+
+// key returns the key stored in Redis and the LocalCache.
+func (cd *Cache) key(ctx context.Context, key string) string {
+	return cd.keyPrefix(ctx) + key
+}
+
+// itemWithKey returns a copy of the item with the prefixed key. The item
+// passed by the caller can be shared by concurrent calls, so it is never
+// modified, while the copy is private to the operation.
+//
+// Item.Do is called with the copy, so the changes it makes, e.g. to TTL,
+// apply to the write. While Do runs, the copy has the original key.
+func (cd *Cache) itemWithKey(item *Item) *Item {
+	prefixed := *item
+
+	prefix := cd.keyPrefix(item.Context())
+	if prefix == "" {
+		return &prefixed
+	}
+
+	prefixed.Key = prefix + item.Key
+	if do := item.Do; do != nil {
+		key := item.Key
+		prefixed.Do = func(it *Item) (interface{}, error) {
+			prefixedKey, wrapper := it.Key, it.Do
+			it.Key, it.Do = key, do
+			defer func() {
+				it.Key, it.Do = prefixedKey, wrapper
+			}()
+			return do(it)
+		}
+	}
+	return &prefixed
+}
+
+func withPrefix(prefix string, keys []string) []string {
+	if prefix == "" {
+		return keys
+	}
+	prefixed := make([]string, len(keys))
+	for i, key := range keys {
+		prefixed[i] = prefix + key
+	}
+	return prefixed
+}
+
+func trimPrefix(prefix string, m map[string][]byte) map[string][]byte {
+	if prefix == "" {
+		return m
+	}
+	trimmed := make(map[string][]byte, len(m))
+	for key, b := range m {
+		trimmed[strings.TrimPrefix(key, prefix)] = b
+	}
+	return trimmed
+}
+
+// prefixedLoader converts the keys passed to and returned by the OnceMany
+// loader.
+func prefixedLoader(
+	prefix string,
+	loader func(missingKeys []string) (map[string]interface{}, error),
+) func(missingKeys []string) (map[string]interface{}, error) {
+	return func(missingKeys []string) (map[string]interface{}, error) {
+		keys := make([]string, len(missingKeys))
+		for i, key := range missingKeys {
+			keys[i] = strings.TrimPrefix(key, prefix)
+		}
+
+		values, err := loader(keys)
+		if values == nil {
+			return nil, err
+		}
+		prefixed := make(map[string]interface{}, len(values))
+		for key, value := range values {
+			prefixed[prefix+key] = value
+		}
+		return prefixed, err
+	}
+}
@@ -0,0 +1,191 @@
+package cache_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/go-redis/cache/v9"
+)
+
+// blockingHook blocks the GET of key while it is enabled until release
+// is closed.
+type blockingHook struct {
+	key     string
+	enabled int32
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (h *blockingHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h *blockingHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		if atomic.LoadInt32(&h.enabled) == 1 && cmd.Name() == "get" && cmd.Args()[1] == h.key {
+			h.entered <- struct{}{}
+			<-h.release
+		}
+		return next(ctx, cmd)
+	}
+}
+
+func (h *blockingHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return next
+}
+
+var _ = Describe("Namespaces", func() {
+	ctx := context.TODO()
+
+	var rdb *redis.Ring
+	var mycache *cache.Cache
+
+	BeforeEach(func() {
+		rdb = newRing()
+		mycache = cache.New(&cache.Options{
+			Redis:      rdb,
+			LocalCache: cache.NewTinyLFU(1000, time.Minute),
+			Prefix:     "svc:",
+		})
+	})
+
+	It("prefixes keys", func() {
+		err := mycache.Set(&cache.Item{Ctx: ctx, Key: "key", Value: "value"})
+		Expect(err).NotTo(HaveOccurred())
+
+		b, err := rdb.Get(ctx, "svc:key").Result()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(b).To(Equal("value"))
+
+		var s string
+		Expect(mycache.GetSkippingLocalCache(ctx, "key", &s)).NotTo(HaveOccurred())
+		Expect(s).To(Equal("value"))
+
+		Expect(mycache.Delete(ctx, "key")).NotTo(HaveOccurred())
+		Expect(mycache.Exists(ctx, "key")).To(BeFalse())
+	})
+
+	It("passes the original key to Do", func() {
+		users := mycache.WithNamespace("user")
+
+		var s string
+		err := users.Once(&cache.Item{
+			Ctx:   ctx,
+			Key:   "1",
+			Value: &s,
+			Do: func(item *cache.Item) (interface{}, error) {
+				return "user " + item.Key, nil
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(s).To(Equal("user 1"))
+
+		b, err := rdb.Get(ctx, "svc:user:v0:1").Result()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(b).To(Equal("user 1"))
+	})
+
+	It("keeps the changes made by Do", func() {
+		err := mycache.Set(&cache.Item{
+			Ctx: ctx,
+			Key: "key",
+			Do: func(item *cache.Item) (interface{}, error) {
+				item.TTL = 5 * time.Minute
+				return "value", nil
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rdb.PTTL(ctx, "svc:key").Val()).To(BeNumerically("~", 5*time.Minute, time.Second))
+	})
+
+	It("invalidates namespaces", func() {
+		users := mycache.WithNamespace("user")
+		posts := mycache.WithNamespace("post")
+
+		for _, c := range []*cache.Cache{users, posts} {
+			err := c.Set(&cache.Item{Ctx: ctx, Key: "1", Value: "value"})
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		Expect(mycache.InvalidateNamespace(ctx, "user")).NotTo(HaveOccurred())
+
+		Expect(users.Exists(ctx, "1")).To(BeFalse())
+		Expect(posts.Exists(ctx, "1")).To(BeTrue())
+
+		other := cache.New(&cache.Options{Redis: rdb, Prefix: "svc:"})
+		Expect(other.WithNamespace("user").Exists(ctx, "1")).To(BeFalse())
+
+		err := users.Set(&cache.Item{Ctx: ctx, Key: "1", Value: "value"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rdb.Exists(ctx, "svc:user:v1:1").Val()).To(Equal(int64(1)))
+	})
+
+	It("uses the last known generation while reading it", func() {
+		hook := &blockingHook{
+			key:     "svc:user:gen",
+			entered: make(chan struct{}, 1),
+			release: make(chan struct{}),
+		}
+		client := redis.NewClient(&redis.Options{Addr: ":6379"})
+		client.AddHook(hook)
+		defer client.Close()
+
+		users := cache.New(&cache.Options{Redis: client, Prefix: "svc:"}).WithNamespace("user")
+		Expect(users.Exists(ctx, "1")).To(BeFalse())
+
+		// Wait until the generation is read again.
+		time.Sleep(1100 * time.Millisecond)
+		atomic.StoreInt32(&hook.enabled, 1)
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			users.Exists(ctx, "1")
+		}()
+		Eventually(hook.entered).Should(Receive())
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			users.Exists(ctx, "1")
+		}()
+		Eventually(done).Should(BeClosed())
+
+		close(hook.release)
+		wg.Wait()
+	})
+
+	It("prefixes keys of multi operations", func() {
+		users := mycache.WithNamespace("user")
+
+		err := users.SetMulti([]*cache.Item{
+			{Ctx: ctx, Key: "1", Value: "one"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		var missing []string
+		m := make(map[string]string)
+		err = users.OnceMany(ctx, []string{"1", "2"}, time.Hour,
+			func(keys []string) (map[string]interface{}, error) {
+				missing = keys
+				return map[string]interface{}{"2": "two"}, nil
+			}, m)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(missing).To(Equal([]string{"2"}))
+		Expect(m).To(Equal(map[string]string{"1": "one", "2": "two"}))
+
+		m = make(map[string]string)
+		Expect(users.GetMulti(ctx, []string{"1", "2"}, m)).NotTo(HaveOccurred())
+		Expect(m).To(HaveLen(2))
+
+		Expect(users.DeleteMulti(ctx, "1", "2")).NotTo(HaveOccurred())
+		Expect(rdb.Exists(ctx, "svc:user:v0:1", "svc:user:v0:2").Val()).To(Equal(int64(0)))
+	})
+})
@@ -0,0 +1,203 @@
+package cache
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Values encoded by the default Marshal start with a header:
+//
+//	magic      4 bytes  envelopeMagic
+//	version    1 byte   envelopeVersion
+//	flags      1 byte
+//	created-at 8 bytes  Unix time in milliseconds
+//	codec      1 byte   Codec.ID
+//	compressor 1 byte   Compressor.ID or 0
+//	xfetch     12 bytes compute time in milliseconds (4) and expiration
+//	                    time in Unix milliseconds (8) if xfetchHeaderFlag is set
+//
+// The header is followed by the encoded and compressed value.
+//
+// Values written by older versions end with a compression byte instead,
+// see parseTrailer. The magic can't
+// start such values: MessagePack never uses 0xc1 and, combined with
+// the version byte, it would be an invalid S2 length.
+const (
+	envelopeMagic   = "\xc1\xff\xff\xff"
+	envelopeVersion = 0x81
+
+	headerLen       = len(envelopeMagic) + 12
+	xfetchHeaderLen = 12
+
+	// xfetchHeaderFlag is set when the header includes the XFetch metadata.
+	xfetchHeaderFlag = 0x1
+)
+
+var errNotEncoded = errors.New("cache: value is not encoded by Marshal")
+
+// Metadata describes a value encoded by the default Marshal.
+type Metadata struct {
+	// Version is the version of the format or 0 for the legacy trailer format.
+	Version byte
+	// CreatedAt is when the value was written. It is zero if unknown.
+	CreatedAt time.Time
+	// Codec is the id of the Codec used to encode the value.
+	Codec byte
+	// Compressor is the id of the Compressor used to compress the value
+	// or 0 if the value is not compressed.
+	Compressor byte
+	// Delta is how long it took to compute the value. It is only recorded
+	// for items with XFetchBeta.
+	Delta time.Duration
+	// ExpireAt is when the value expires. It is only recorded for items
+	// with XFetchBeta.
+	ExpireAt time.Time
+}
+
+// Inspect decodes the metadata of a value encoded by Marshal,
+// e.g. read from Redis directly.
+func (cd *Cache) Inspect(b []byte) (*Metadata, error) {
+	if cd.opt.Marshal != nil {
+		return nil, errNotEncoded
+	}
+	if isNotFound(b) {
+		return nil, ErrNotFound
+	}
+	_, meta, err := parsePayload(b)
+	if err != nil {
+		return nil, err
+	}
+	return &meta, nil
+}
+
+func (cd *Cache) encode(value interface{}, meta *Metadata) ([]byte, error) {
+	switch value := value.(type) {
+	case nil:
+		return nil, nil
+	case []byte:
+		return value, nil
+	case string:
+		return []byte(value), nil
+	}
+
+	data, err := cd.codec.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	meta.Version = envelopeVersion
+	meta.Codec = cd.codec.ID()
+	meta.Compressor = noCompression
+	if meta.CreatedAt.IsZero() {
+		meta.CreatedAt = time.Now()
+	}
+
+	if cd.compressionThreshold >= 0 && len(data) >= cd.compressionThreshold {
+		data, err = cd.compressor.Compress(data)
+		if err != nil {
+			return nil, err
+		}
+		meta.Compressor = cd.compressor.ID()
+	}
+
+	b := make([]byte, 0, headerLen+xfetchHeaderLen+len(data))
+	b = appendHeader(b, meta)
+	return append(b, data...), nil
+}
+
+func appendHeader(b []byte, meta *Metadata) []byte {
+	var flags byte
+	if !meta.ExpireAt.IsZero() {
+		flags |= xfetchHeaderFlag
+	}
+
+	b = append(b, envelopeMagic...)
+	b = append(b, meta.Version, flags)
+	b = appendUint64(b, uint64(unixMilli(meta.CreatedAt)))
+	b = append(b, meta.Codec, meta.Compressor)
+	if flags&xfetchHeaderFlag != 0 {
+		b = appendUint32(b, uint32(meta.Delta/time.Millisecond))
+		b = appendUint64(b, uint64(unixMilli(meta.ExpireAt)))
+	}
+	return b
+}
+
+// parsePayload parses the metadata of b and returns the remaining
+// compressed data.
+func parsePayload(b []byte) (data []byte, meta Metadata, err error) {
+	if len(b) >= len(envelopeMagic) && string(b[:len(envelopeMagic)]) == envelopeMagic {
+		return parseHeader(b)
+	}
+	return parseTrailer(b)
+}
+
+func parseHeader(b []byte) (data []byte, meta Metadata, err error) {
+	if len(b) < headerLen {
+		return nil, meta, errPayloadTooShort
+	}
+
+	b = b[len(envelopeMagic):]
+	meta.Version = b[0]
+	if meta.Version != envelopeVersion {
+		return nil, meta, fmt.Errorf("cache: unsupported payload version: %x", meta.Version)
+	}
+
+	flags := b[1]
+	if flags&^xfetchHeaderFlag != 0 {
+		return nil, meta, fmt.Errorf("cache: unsupported payload flags: %x", flags)
+	}
+
+	meta.CreatedAt = fromUnixMilli(int64(binary.BigEndian.Uint64(b[2:])))
+	meta.Codec = b[10]
+	meta.Compressor = b[11]
+	b = b[12:]
+
+	if flags&xfetchHeaderFlag != 0 {
+		if len(b) < xfetchHeaderLen {
+			return nil, meta, errPayloadTooShort
+		}
+		meta.Delta = time.Duration(binary.BigEndian.Uint32(b)) * time.Millisecond
+		meta.ExpireAt = fromUnixMilli(int64(binary.BigEndian.Uint64(b[4:])))
+		b = b[xfetchHeaderLen:]
+	}
+
+	return b, meta, nil
+}
+
+// parseTrailer parses the compression byte at the end of b written by older
+// versions. Such values are always encoded with MessagePack and either not
+// compressed or compressed with S2.
+func parseTrailer(b []byte) (data []byte, meta Metadata, err error) {
+	if len(b) == 0 {
+		return nil, meta, errPayloadTooShort
+	}
+
+	c := b[len(b)-1]
+	switch c {
+	case noCompression, s2CompressorID:
+	default:
+		return nil, meta, fmt.Errorf("cache: unknown compression method: %x", c)
+	}
+
+	meta.Codec = msgpackCodecID
+	meta.Compressor = c
+	return b[:len(b)-1], meta, nil
+}
+
+func appendUint32(b []byte, n uint32) []byte {
+	return append(b, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+}
+
+func appendUint64(b []byte, n uint64) []byte {
+	return appendUint32(appendUint32(b, uint32(n>>32)), uint32(n))
+}
+
+func unixMilli(tm time.Time) int64 {
+	return tm.UnixNano() / int64(time.Millisecond)
+}
+
+func fromUnixMilli(ms int64) time.Time {
+	return time.Unix(0, ms*int64(time.Millisecond))
+}
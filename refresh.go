@@ -0,0 +1,310 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	refreshWorkers = 4
+	// refreshJitter is the maximum fraction of the refresh interval that is
+	// added to or subtracted from it.
+	refreshJitter = 0.1
+	// refreshLeaderTTL is the lease of the instance that refreshes the keys.
+	refreshLeaderTTL = 10 * time.Second
+	// refreshMinBackoff is the delay before the first retry of a failed refresh.
+	refreshMinBackoff = time.Second
+)
+
+var errCacheClosed = errors.New("cache: cache is closed")
+
+// renewScript extends the lock only if it is still held by the given token.
+const renewScript = `
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("pexpire", KEYS[1], ARGV[2])
+end
+return 0
+`
+
+// Register keeps the key refreshed in background, so it never expires.
+// The value is loaded with Once before Register returns and then recomputed
+// with Do every refreshInterval with a small jitter and cached with the
+// given ttl, which should be longer than refreshInterval. If Do fails,
+// the refresh is retried with exponential backoff up to refreshInterval.
+//
+// When several instances share Redis, only the instance holding the leader
+// lease calls Do; the others copy the value from Redis into their
+// LocalCache. The leader only refreshes the keys it registered, so the
+// others still call Do when the value is missing in Redis or expires
+// before their next refresh, e.g. during a rolling deploy that adds a key.
+// This also happens if ttl is shorter than about twice refreshInterval.
+// Registering the key again replaces the previous registration.
+// Close stops the refreshes.
+func (cd *Cache) Register(
+	key string,
+	ttl, refreshInterval time.Duration,
+	do func(*Item) (interface{}, error),
+) error {
+	if refreshInterval <= 0 {
+		return errors.New("cache: refreshInterval must be positive")
+	}
+
+	r, err := cd.getRefresher()
+	if err != nil {
+		return err
+	}
+
+	e := &refreshEntry{
+		cd:       cd,
+		id:       key,
+		key:      key,
+		ttl:      ttl,
+		interval: refreshInterval,
+		do:       do,
+	}
+	if err := cd.Once(e.item(r.ctx)); err != nil {
+		return err
+	}
+
+	if cd.ns != nil {
+		e.id = cd.ns.name + ":" + key
+	}
+	return r.add(e)
+}
+
+func (cd *Cache) getRefresher() (*refresher, error) {
+	cd.refresherMu.Lock()
+	defer cd.refresherMu.Unlock()
+
+	if cd.closed {
+		return nil, errCacheClosed
+	}
+	if cd.refresher == nil {
+		cd.refresher = newRefresher(cd)
+	}
+	return cd.refresher, nil
+}
+
+type refreshEntry struct {
+	cd *Cache
+	// id identifies the registration. Unlike the key stored in Redis,
+	// it does not include the namespace generation.
+	id       string
+	key      string
+	ttl      time.Duration
+	interval time.Duration
+	do       func(*Item) (interface{}, error)
+
+	// failures is only used by the worker refreshing the entry.
+	failures int
+	// timer is protected by refresher.mu.
+	timer *time.Timer
+}
+
+func (e *refreshEntry) item(ctx context.Context) *Item {
+	return &Item{
+		Ctx: ctx,
+		Key: e.key,
+		TTL: e.ttl,
+		Do:  e.do,
+	}
+}
+
+// maxDelay returns the longest delay before the next successful refresh.
+func (e *refreshEntry) maxDelay() time.Duration {
+	return e.interval + time.Duration(refreshJitter*float64(e.interval))
+}
+
+// nextDelay returns the delay before the next refresh.
+func (e *refreshEntry) nextDelay(err error) time.Duration {
+	if err == nil {
+		e.failures = 0
+		jitter := (rand.Float64()*2 - 1) * refreshJitter * float64(e.interval)
+		return e.interval + time.Duration(jitter)
+	}
+
+	e.failures++
+	backoff := refreshMinBackoff
+	for i := 1; i < e.failures && backoff < e.interval; i++ {
+		backoff *= 2
+	}
+	if backoff > e.interval {
+		backoff = e.interval
+	}
+	return backoff
+}
+
+// refresher refreshes the registered keys using a pool of workers.
+type refresher struct {
+	cd *Cache
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	work   chan *refreshEntry
+	wg     sync.WaitGroup
+
+	leaderKey string
+	token     string
+	leader    int32
+
+	mu      sync.Mutex
+	entries map[string]*refreshEntry
+	closed  bool
+}
+
+func newRefresher(cd *Cache) *refresher {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &refresher{
+		cd:        cd,
+		ctx:       ctx,
+		cancel:    cancel,
+		work:      make(chan *refreshEntry),
+		leaderKey: cd.opt.Prefix + "cache:refresh:leader",
+		token:     randomID(),
+		entries:   make(map[string]*refreshEntry),
+	}
+
+	for i := 0; i < refreshWorkers; i++ {
+		r.wg.Add(1)
+		go r.worker()
+	}
+
+	if cd.opt.Redis == nil {
+		r.leader = 1
+	} else {
+		r.elect()
+		r.wg.Add(1)
+		go r.electLoop()
+	}
+
+	return r
+}
+
+func (r *refresher) add(e *refreshEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return errCacheClosed
+	}
+	if old, ok := r.entries[e.id]; ok {
+		old.timer.Stop()
+	}
+	r.entries[e.id] = e
+	r.scheduleLocked(e, e.nextDelay(nil))
+	return nil
+}
+
+func (r *refresher) scheduleLocked(e *refreshEntry, delay time.Duration) {
+	e.timer = time.AfterFunc(delay, func() {
+		select {
+		case r.work <- e:
+		case <-r.ctx.Done():
+		}
+	})
+}
+
+func (r *refresher) worker() {
+	defer r.wg.Done()
+
+	for {
+		select {
+		case e := <-r.work:
+			err := r.refresh(e)
+
+			r.mu.Lock()
+			if !r.closed && r.entries[e.id] == e {
+				r.scheduleLocked(e, e.nextDelay(err))
+			}
+			r.mu.Unlock()
+		case <-r.ctx.Done():
+			return
+		}
+	}
+}
+
+func (r *refresher) refresh(e *refreshEntry) error {
+	item := e.item(r.ctx)
+
+	if atomic.LoadInt32(&r.leader) == 0 {
+		// The leader refreshes Redis, so usually only the LocalCache
+		// is updated.
+		key := e.cd.key(r.ctx, e.key)
+		_, ttl, err := e.cd.getBytesWithTTL(r.ctx, key, item.localTTL())
+		if err == nil && (ttl == 0 || ttl > e.maxDelay()) {
+			return nil
+		}
+		if err != nil && err != ErrCacheMiss {
+			return err
+		}
+	}
+
+	err := e.cd.Set(item)
+	if err != nil && r.ctx.Err() == nil {
+		log.Printf("cache: refreshing key=%q failed: %s", e.key, err)
+	}
+	return err
+}
+
+func (r *refresher) electLoop() {
+	defer r.wg.Done()
+
+	ticker := time.NewTicker(refreshLeaderTTL / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			r.elect()
+		case <-r.ctx.Done():
+			return
+		}
+	}
+}
+
+// elect acquires or renews the leader lease.
+func (r *refresher) elect() {
+	rdb := r.cd.opt.Redis
+	ttl := refreshLeaderTTL
+
+	var leader bool
+	if atomic.LoadInt32(&r.leader) == 1 {
+		n, err := rdb.Eval(r.ctx, renewScript, []string{r.leaderKey},
+			r.token, ttl.Milliseconds()).Int()
+		leader = err == nil && n == 1
+	}
+	if !leader {
+		leader, _ = rdb.SetNX(r.ctx, r.leaderKey, r.token, ttl).Result()
+	}
+
+	var v int32
+	if leader {
+		v = 1
+	}
+	atomic.StoreInt32(&r.leader, v)
+}
+
+func (r *refresher) close() {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return
+	}
+	r.closed = true
+	for _, e := range r.entries {
+		e.timer.Stop()
+	}
+	r.mu.Unlock()
+
+	r.cancel()
+	r.wg.Wait()
+
+	if r.cd.opt.Redis != nil && atomic.LoadInt32(&r.leader) == 1 {
+		r.cd.unlock(context.Background(), r.leaderKey, r.token)
+	}
+}
@@ -0,0 +1,131 @@
+package cache_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/go-redis/cache/v9"
+)
+
+var _ = Describe("Register", func() {
+	ctx := context.TODO()
+
+	var rdb *redis.Ring
+	var mycache *cache.Cache
+
+	BeforeEach(func() {
+		rdb = newRing()
+		mycache = newCacheWithLocal(rdb)
+	})
+
+	AfterEach(func() {
+		_ = mycache.Close()
+	})
+
+	It("refreshes registered keys", func() {
+		var calls int64
+		err := mycache.Register("key", time.Hour, 50*time.Millisecond,
+			func(*cache.Item) (interface{}, error) {
+				return atomic.AddInt64(&calls, 1), nil
+			})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(atomic.LoadInt64(&calls)).To(Equal(int64(1)))
+
+		Eventually(func() int64 {
+			var n int64
+			_ = mycache.GetSkippingLocalCache(ctx, "key", &n)
+			return n
+		}).Should(BeNumerically(">=", 3))
+
+		Expect(mycache.Close()).NotTo(HaveOccurred())
+		n := atomic.LoadInt64(&calls)
+		time.Sleep(200 * time.Millisecond)
+		Expect(atomic.LoadInt64(&calls)).To(Equal(n))
+
+		err = mycache.Register("key", time.Hour, time.Second, nil)
+		Expect(err).To(MatchError("cache: cache is closed"))
+	})
+
+	It("returns the error of the first load", func() {
+		err := mycache.Register("key", time.Hour, time.Second,
+			func(*cache.Item) (interface{}, error) {
+				return nil, errors.New("loader failed")
+			})
+		Expect(err).To(MatchError("loader failed"))
+	})
+
+	It("refreshes keys on one instance", func() {
+		other := newCacheWithLocal(rdb)
+		defer other.Close()
+
+		var calls, otherCalls int64
+		err := mycache.Register("key", time.Hour, 50*time.Millisecond,
+			func(*cache.Item) (interface{}, error) {
+				return atomic.AddInt64(&calls, 1), nil
+			})
+		Expect(err).NotTo(HaveOccurred())
+
+		err = other.Register("key", time.Hour, 50*time.Millisecond,
+			func(*cache.Item) (interface{}, error) {
+				return atomic.AddInt64(&otherCalls, 1), nil
+			})
+		Expect(err).NotTo(HaveOccurred())
+
+		Eventually(func() int64 {
+			return atomic.LoadInt64(&calls)
+		}).Should(BeNumerically(">=", 3))
+		Expect(atomic.LoadInt64(&otherCalls)).To(Equal(int64(0)))
+
+		Eventually(func() int64 {
+			var n int64
+			_ = other.Get(ctx, "key", &n)
+			return n
+		}).Should(BeNumerically(">=", 3))
+	})
+
+	It("refreshes keys registered only on other instances", func() {
+		other := newCacheWithLocal(rdb)
+		defer other.Close()
+
+		err := mycache.Register("key", time.Hour, time.Hour,
+			func(*cache.Item) (interface{}, error) {
+				return "value", nil
+			})
+		Expect(err).NotTo(HaveOccurred())
+
+		var otherCalls int64
+		err = other.Register("other-key", time.Hour, 50*time.Millisecond,
+			func(*cache.Item) (interface{}, error) {
+				return atomic.AddInt64(&otherCalls, 1), nil
+			})
+		Expect(err).NotTo(HaveOccurred())
+
+		// other is not the leader, so the key is not recomputed
+		// while it exists.
+		time.Sleep(200 * time.Millisecond)
+		Expect(atomic.LoadInt64(&otherCalls)).To(Equal(int64(1)))
+
+		Expect(rdb.Del(ctx, "other-key").Err()).NotTo(HaveOccurred())
+		Eventually(func() int64 {
+			return atomic.LoadInt64(&otherCalls)
+		}).Should(Equal(int64(2)))
+		Eventually(func() int64 {
+			return rdb.Exists(ctx, "other-key").Val()
+		}).Should(Equal(int64(1)))
+
+		// The key is recomputed before it expires.
+		Expect(rdb.PExpire(ctx, "other-key", 10*time.Millisecond).Err()).NotTo(HaveOccurred())
+		Eventually(func() int64 {
+			return atomic.LoadInt64(&otherCalls)
+		}).Should(Equal(int64(3)))
+		Eventually(func() time.Duration {
+			return rdb.PTTL(ctx, "other-key").Val()
+		}).Should(BeNumerically(">", time.Minute))
+	})
+})
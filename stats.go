@@ -0,0 +1,298 @@
+package cache
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+type Stats struct {
+	// Hits is the number of values found in Redis.
+	//
+	// Deprecated: use RedisHits.
+	Hits uint64
+	// Misses is the number of Redis lookups that did not return a value,
+	// including Redis errors and lookups skipped by the circuit breaker.
+	Misses uint64
+
+	// LocalHits is the number of values found in the LocalCache.
+	LocalHits uint64
+	// LocalMisses is the number of values not found in the LocalCache.
+	LocalMisses uint64
+
+	// RedisHits is the number of values found in Redis.
+	RedisHits uint64
+	// RedisMisses is the number of values not found in Redis.
+	RedisMisses uint64
+	// RedisErrors is the number of failed Redis commands and pipelines.
+	RedisErrors uint64
+
+	// LoaderCalls is the number of Item.Do and OnceMany loader calls.
+	LoaderCalls uint64
+	// LoaderErrors is the number of loader calls that failed, not counting
+	// ErrNotFound.
+	LoaderErrors uint64
+	// SingleflightDedups is the number of Once calls and OnceMany keys that
+	// got the result of a concurrent call for the same key instead of
+	// loading it.
+	SingleflightDedups uint64
+
+	// BytesRead is the number of value bytes read from Redis.
+	BytesRead uint64
+	// BytesWritten is the number of value bytes written to Redis.
+	BytesWritten uint64
+
+	// UnmarshalErrors is the number of values that could not be decoded.
+	UnmarshalErrors uint64
+
+	// LocalCacheSize is the number of entries in the LocalCache if it
+	// implements LocalCacheWithLen, or -1.
+	LocalCacheSize int
+
+	// Circuit is the state of the circuit breaker.
+	Circuit CircuitState
+}
+
+type stats struct {
+	misses             uint64
+	localHits          uint64
+	localMisses        uint64
+	redisHits          uint64
+	redisMisses        uint64
+	redisErrors        uint64
+	loaderCalls        uint64
+	loaderErrors       uint64
+	singleflightDedups uint64
+	bytesRead          uint64
+	bytesWritten       uint64
+	unmarshalErrors    uint64
+}
+
+func (s *stats) counters() []*uint64 {
+	return []*uint64{
+		&s.misses,
+		&s.localHits,
+		&s.localMisses,
+		&s.redisHits,
+		&s.redisMisses,
+		&s.redisErrors,
+		&s.loaderCalls,
+		&s.loaderErrors,
+		&s.singleflightDedups,
+		&s.bytesRead,
+		&s.bytesWritten,
+		&s.unmarshalErrors,
+	}
+}
+
+// incr increments the counter if stats are enabled.
+func (cd *Cache) incr(counter *uint64, n uint64) {
+	if cd.opt.StatsEnabled {
+		atomic.AddUint64(counter, n)
+	}
+}
+
+// Name returns Options.Name.
+func (cd *Cache) Name() string {
+	return cd.opt.Name
+}
+
+// Stats returns cache statistics.
+func (cd *Cache) Stats() *Stats {
+	if !cd.opt.StatsEnabled {
+		return nil
+	}
+
+	localCacheSize := -1
+	if c, ok := cd.opt.LocalCache.(LocalCacheWithLen); ok {
+		localCacheSize = c.Len()
+	}
+
+	redisHits := atomic.LoadUint64(&cd.stats.redisHits)
+	return &Stats{
+		Hits:   redisHits,
+		Misses: atomic.LoadUint64(&cd.stats.misses),
+
+		LocalHits:   atomic.LoadUint64(&cd.stats.localHits),
+		LocalMisses: atomic.LoadUint64(&cd.stats.localMisses),
+
+		RedisHits:   redisHits,
+		RedisMisses: atomic.LoadUint64(&cd.stats.redisMisses),
+		RedisErrors: atomic.LoadUint64(&cd.stats.redisErrors),
+
+		LoaderCalls:        atomic.LoadUint64(&cd.stats.loaderCalls),
+		LoaderErrors:       atomic.LoadUint64(&cd.stats.loaderErrors),
+		SingleflightDedups: atomic.LoadUint64(&cd.stats.singleflightDedups),
+
+		BytesRead:    atomic.LoadUint64(&cd.stats.bytesRead),
+		BytesWritten: atomic.LoadUint64(&cd.stats.bytesWritten),
+
+		UnmarshalErrors: atomic.LoadUint64(&cd.stats.unmarshalErrors),
+
+		LocalCacheSize: localCacheSize,
+
+		Circuit: cd.breaker.State(),
+	}
+}
+
+// ResetStats resets the counters returned by Stats and StatsByGroup.
+// The counters are reset one by one, so a concurrent call to Stats may see
+// some of them reset.
+func (cd *Cache) ResetStats() {
+	for _, counter := range cd.stats.counters() {
+		atomic.StoreUint64(counter, 0)
+	}
+
+	cd.groupsMu.Lock()
+	cd.groups = nil
+	cd.groupsMu.Unlock()
+}
+
+// unmarshalValue is like unmarshal, but counts the errors.
+func (cd *Cache) unmarshalValue(b []byte, value interface{}) error {
+	err := cd.unmarshal(b, value)
+	if err != nil && err != ErrNotFound {
+		cd.incr(&cd.stats.unmarshalErrors, 1)
+	}
+	return err
+}
+
+// redisDone reports the result of a Redis command to the circuit breaker
+// and counts the errors.
+func (cd *Cache) redisDone(err error) {
+	cd.breaker.done(err)
+	if err != nil && err != redis.Nil {
+		cd.incr(&cd.stats.redisErrors, 1)
+	}
+}
+
+//------------------------------------------------------------------------------
+
+// StatsOtherGroup is the group that StatsByGroup uses for the keys of
+// the groups over the limit. See Options.StatsKeyFunc.
+const StatsOtherGroup = "other"
+
+const maxStatsGroups = 100
+
+// GroupStats is the statistics of a group of keys.
+// See Options.StatsKeyFunc.
+type GroupStats struct {
+	// Hits is the number of keys read by Get, Exists, Once, GetMulti and
+	// OnceMany that were found in the LocalCache or Redis.
+	Hits uint64
+	// Misses is the number of keys read by Get, Exists, Once, GetMulti and
+	// OnceMany that were not found in the cache.
+	Misses uint64
+	// Latency is the total duration of the calls. The duration of GetMulti
+	// and OnceMany is split evenly among their keys.
+	Latency time.Duration
+}
+
+// AvgLatency returns the average duration of a call.
+func (s *GroupStats) AvgLatency() time.Duration {
+	calls := s.Hits + s.Misses
+	if calls == 0 {
+		return 0
+	}
+	return s.Latency / time.Duration(calls)
+}
+
+type groupStats struct {
+	hits    uint64
+	misses  uint64
+	latency int64
+}
+
+func (s *groupStats) record(hit bool, d time.Duration) {
+	if hit {
+		atomic.AddUint64(&s.hits, 1)
+	} else {
+		atomic.AddUint64(&s.misses, 1)
+	}
+	atomic.AddInt64(&s.latency, int64(d))
+}
+
+// StatsByGroup returns the statistics of the key groups returned by
+// Options.StatsKeyFunc.
+func (cd *Cache) StatsByGroup() map[string]*GroupStats {
+	if !cd.opt.StatsEnabled || cd.opt.StatsKeyFunc == nil {
+		return nil
+	}
+
+	cd.groupsMu.RLock()
+	defer cd.groupsMu.RUnlock()
+
+	m := make(map[string]*GroupStats, len(cd.groups))
+	for name, s := range cd.groups {
+		m[name] = &GroupStats{
+			Hits:    atomic.LoadUint64(&s.hits),
+			Misses:  atomic.LoadUint64(&s.misses),
+			Latency: time.Duration(atomic.LoadInt64(&s.latency)),
+		}
+	}
+	return m
+}
+
+// withGroupStats records the result of the Get or Once call in the stats
+// of the group of the key, which does not include Options.Prefix and
+// the namespace.
+func (cd *Cache) withGroupStats(key string, event *Event, fn func() error) error {
+	if !cd.opt.StatsEnabled || cd.opt.StatsKeyFunc == nil {
+		return fn()
+	}
+
+	start := time.Now()
+	err := fn()
+	hit := event.Tier == TierLocal || event.Tier == TierRedis
+	cd.groupStats(key).record(hit, time.Since(start))
+	return err
+}
+
+// recordMultiGroupStats records the result of the GetMulti or OnceMany call
+// for each key in the stats of its group. The keys found in the cache are
+// hits, and the duration of the call is split evenly among the keys.
+func (cd *Cache) recordMultiGroupStats(
+	keys, prefixedKeys []string, cached map[string][]byte, start time.Time,
+) {
+	if !cd.opt.StatsEnabled || cd.opt.StatsKeyFunc == nil || len(keys) == 0 {
+		return
+	}
+
+	d := time.Since(start) / time.Duration(len(keys))
+	for i, key := range keys {
+		_, hit := cached[prefixedKeys[i]]
+		cd.groupStats(key).record(hit, d)
+	}
+}
+
+func (cd *Cache) groupStats(key string) *groupStats {
+	name := cd.opt.StatsKeyFunc(key)
+
+	cd.groupsMu.RLock()
+	s, ok := cd.groups[name]
+	cd.groupsMu.RUnlock()
+	if ok {
+		return s
+	}
+
+	cd.groupsMu.Lock()
+	defer cd.groupsMu.Unlock()
+
+	if s, ok := cd.groups[name]; ok {
+		return s
+	}
+	if len(cd.groups) >= maxStatsGroups {
+		name = StatsOtherGroup
+		if s, ok := cd.groups[name]; ok {
+			return s
+		}
+	}
+
+	if cd.groups == nil {
+		cd.groups = make(map[string]*groupStats)
+	}
+	s = new(groupStats)
+	cd.groups[name] = s
+	return s
+}
@@ -0,0 +1,243 @@
+package cache_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/go-redis/cache/v9"
+)
+
+var _ = Describe("Stats", func() {
+	ctx := context.TODO()
+
+	var mycache *cache.Cache
+
+	BeforeEach(func() {
+		mycache = cache.New(&cache.Options{
+			Redis:        newRing(),
+			LocalCache:   cache.NewTinyLFU(1000, time.Minute),
+			StatsEnabled: true,
+		})
+	})
+
+	It("counts hits and loader calls", func() {
+		once := func(key string, err error) {
+			var s string
+			_ = mycache.Once(&cache.Item{
+				Ctx:   ctx,
+				Key:   key,
+				Value: &s,
+				Do: func(*cache.Item) (interface{}, error) {
+					return "value", err
+				},
+			})
+		}
+
+		once("key1", nil)
+		once("key1", nil)
+		once("key2", errors.New("loader failed"))
+
+		var n int
+		err := mycache.Set(&cache.Item{Ctx: ctx, Key: "key3", Value: "value"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(mycache.Get(ctx, "key3", &n)).To(HaveOccurred())
+
+		stats := mycache.Stats()
+		Expect(stats.Hits).To(Equal(uint64(0)))
+		Expect(stats.Misses).To(Equal(uint64(2)))
+		Expect(stats.LocalHits).To(Equal(uint64(2)))
+		Expect(stats.LocalMisses).To(Equal(uint64(2)))
+		Expect(stats.RedisMisses).To(Equal(uint64(2)))
+		Expect(stats.LoaderCalls).To(Equal(uint64(2)))
+		Expect(stats.LoaderErrors).To(Equal(uint64(1)))
+		Expect(stats.UnmarshalErrors).To(Equal(uint64(1)))
+		Expect(stats.LocalCacheSize).To(Equal(2))
+	})
+
+	It("counts singleflight dedups", func() {
+		release := make(chan struct{})
+		done := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			defer close(done)
+
+			err := mycache.Once(&cache.Item{
+				Ctx: ctx,
+				Key: "key",
+				Do: func(*cache.Item) (interface{}, error) {
+					<-release
+					return "value", nil
+				},
+			})
+			Expect(err).NotTo(HaveOccurred())
+		}()
+
+		time.Sleep(100 * time.Millisecond)
+		go func() {
+			time.Sleep(100 * time.Millisecond)
+			close(release)
+		}()
+
+		err := mycache.Once(&cache.Item{Ctx: ctx, Key: "key"})
+		Expect(err).NotTo(HaveOccurred())
+		<-done
+
+		Expect(mycache.Stats().SingleflightDedups).To(Equal(uint64(1)))
+	})
+
+	It("counts Redis lookups and bytes", func() {
+		err := mycache.Set(&cache.Item{Ctx: ctx, Key: "key", Value: "value"})
+		Expect(err).NotTo(HaveOccurred())
+
+		var s string
+		err = mycache.GetSkippingLocalCache(ctx, "key", &s)
+		Expect(err).NotTo(HaveOccurred())
+
+		m := make(map[string]string)
+		err = mycache.GetMulti(ctx, []string{"key", "missing"}, m)
+		Expect(err).NotTo(HaveOccurred())
+
+		stats := mycache.Stats()
+		Expect(stats.RedisHits).To(Equal(uint64(1)))
+		Expect(stats.Hits).To(Equal(uint64(1)))
+		Expect(stats.RedisMisses).To(Equal(uint64(1)))
+		Expect(stats.RedisErrors).To(Equal(uint64(0)))
+		Expect(stats.LocalHits).To(Equal(uint64(1)))
+		Expect(stats.LocalMisses).To(Equal(uint64(1)))
+		Expect(stats.BytesWritten).To(Equal(uint64(len("value"))))
+		Expect(stats.BytesRead).To(Equal(uint64(len("value"))))
+	})
+
+	It("resets stats", func() {
+		var s string
+		err := mycache.Once(&cache.Item{
+			Ctx:   ctx,
+			Key:   "key",
+			Value: &s,
+			Do: func(*cache.Item) (interface{}, error) {
+				return "value", nil
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(mycache.Stats().LoaderCalls).To(Equal(uint64(1)))
+
+		mycache.ResetStats()
+
+		stats := mycache.Stats()
+		Expect(stats.LoaderCalls).To(Equal(uint64(0)))
+		Expect(stats.LocalMisses).To(Equal(uint64(0)))
+		Expect(stats.BytesWritten).To(Equal(uint64(0)))
+		Expect(stats.LocalCacheSize).To(Equal(1))
+	})
+
+	It("groups stats by key prefix", func() {
+		mycache = cache.New(&cache.Options{
+			Redis:        newRing(),
+			LocalCache:   cache.NewTinyLFU(1000, time.Minute),
+			StatsEnabled: true,
+			StatsKeyFunc: func(key string) string {
+				return strings.SplitN(key, ":", 2)[0]
+			},
+		})
+
+		err := mycache.Set(&cache.Item{Ctx: ctx, Key: "user:1", Value: "value"})
+		Expect(err).NotTo(HaveOccurred())
+
+		var s string
+		Expect(mycache.Get(ctx, "user:1", &s)).NotTo(HaveOccurred())
+		Expect(mycache.Get(ctx, "user:2", &s)).To(Equal(cache.ErrCacheMiss))
+		err = mycache.Once(&cache.Item{
+			Ctx:   ctx,
+			Key:   "post:1",
+			Value: &s,
+			Do: func(*cache.Item) (interface{}, error) {
+				return "value", nil
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		groups := mycache.StatsByGroup()
+		Expect(groups).To(HaveLen(2))
+		Expect(groups["user"].Hits).To(Equal(uint64(1)))
+		Expect(groups["user"].Misses).To(Equal(uint64(1)))
+		Expect(groups["user"].Latency).To(BeNumerically(">", 0))
+		Expect(groups["post"].Hits).To(Equal(uint64(0)))
+		Expect(groups["post"].Misses).To(Equal(uint64(1)))
+
+		mycache.ResetStats()
+		Expect(mycache.StatsByGroup()).To(BeEmpty())
+	})
+
+	It("groups keys without the prefix", func() {
+		mycache = cache.New(&cache.Options{
+			Redis:        newRing(),
+			Prefix:       "svc:v3:",
+			StatsEnabled: true,
+			StatsKeyFunc: func(key string) string {
+				return strings.SplitN(key, ":", 2)[0]
+			},
+		})
+
+		var s string
+		Expect(mycache.Get(ctx, "user:1", &s)).To(Equal(cache.ErrCacheMiss))
+		Expect(mycache.WithNamespace("ns").Get(ctx, "order:1", &s)).To(Equal(cache.ErrCacheMiss))
+
+		groups := mycache.StatsByGroup()
+		Expect(groups).To(HaveLen(2))
+		Expect(groups["user"].Misses).To(Equal(uint64(1)))
+		Expect(groups["order"].Misses).To(Equal(uint64(1)))
+	})
+
+	It("groups keys of multi operations", func() {
+		mycache = cache.New(&cache.Options{
+			Redis:        newRing(),
+			Prefix:       "svc:",
+			StatsEnabled: true,
+			StatsKeyFunc: func(key string) string {
+				return strings.SplitN(key, ":", 2)[0]
+			},
+		})
+
+		err := mycache.SetMulti([]*cache.Item{{Ctx: ctx, Key: "user:1", Value: "value"}})
+		Expect(err).NotTo(HaveOccurred())
+
+		m := make(map[string]string)
+		Expect(mycache.GetMulti(ctx, []string{"user:1", "user:2"}, m)).NotTo(HaveOccurred())
+		err = mycache.OnceMany(ctx, []string{"user:1", "post:1"}, time.Hour,
+			func(keys []string) (map[string]interface{}, error) {
+				return map[string]interface{}{"post:1": "value"}, nil
+			}, m)
+		Expect(err).NotTo(HaveOccurred())
+
+		groups := mycache.StatsByGroup()
+		Expect(groups).To(HaveLen(2))
+		Expect(groups["user"].Hits).To(Equal(uint64(2)))
+		Expect(groups["user"].Misses).To(Equal(uint64(1)))
+		Expect(groups["post"].Hits).To(Equal(uint64(0)))
+		Expect(groups["post"].Misses).To(Equal(uint64(1)))
+	})
+
+	It("limits the number of groups", func() {
+		mycache = cache.New(&cache.Options{
+			LocalCache:   cache.NewTinyLFU(1000, time.Minute),
+			StatsEnabled: true,
+			StatsKeyFunc: func(key string) string {
+				return key
+			},
+		})
+
+		for i := 0; i < 150; i++ {
+			_ = mycache.Get(ctx, strconv.Itoa(i), nil)
+		}
+
+		groups := mycache.StatsByGroup()
+		Expect(groups).To(HaveLen(101))
+		Expect(groups[cache.StatsOtherGroup].Misses).To(Equal(uint64(50)))
+	})
+})
@@ -0,0 +1,100 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	errTagsRedisNil = errors.New("cache: tags require Redis")
+
+	errTagsInvalidationNil = errors.New(
+		"cache: tags with LocalCache require InvalidationChannel or Tracking")
+)
+
+// popTagScript atomically returns the members of the tag set and deletes it,
+// so keys tagged concurrently are not lost.
+const popTagScript = `
+local keys = redis.call("smembers", KEYS[1])
+redis.call("del", KEYS[1])
+return keys
+`
+
+// tagKey returns the key of the tag set. Tags are shared by the namespaces,
+// but not by caches with different Options.Prefix.
+func (cd *Cache) tagKey(tag string) string {
+	return cd.opt.Prefix + "cache:tag:" + tag
+}
+
+// addTags adds the item key to the sets of its tags. The sets live at least
+// as long as the longest-lived key in them.
+func (cd *Cache) addTags(pipe redis.Pipeliner, item *Item, ttl time.Duration) {
+	ctx := item.Context()
+	for _, tag := range item.Tags {
+		key := cd.tagKey(tag)
+		pipe.SAdd(ctx, key, item.Key)
+		pipe.ExpireNX(ctx, key, ttl)
+		pipe.ExpireGT(ctx, key, ttl)
+	}
+}
+
+// checkTags returns an error if the LocalCache of other processes can't be
+// notified when the tagged keys are invalidated.
+func (cd *Cache) checkTags(tags []string) error {
+	if len(tags) == 0 || cd.opt.LocalCache == nil {
+		return nil
+	}
+	if cd.invalidator == nil && cd.tracker == nil {
+		return errTagsInvalidationNil
+	}
+	return nil
+}
+
+// InvalidateTags deletes all keys associated with the given tags using
+// Item.Tags from Redis and the LocalCache of all processes. The other
+// processes are notified using the invalidation bus or tracking, which
+// is why caches with a LocalCache can't use tags without either
+// Options.InvalidationChannel or Options.Tracking.
+func (cd *Cache) InvalidateTags(ctx context.Context, tags ...string) error {
+	if cd.opt.Redis == nil {
+		return errTagsRedisNil
+	}
+	if err := cd.checkTags(tags); err != nil {
+		return err
+	}
+	if len(tags) == 0 {
+		return nil
+	}
+
+	if !cd.breaker.allow() {
+		return ErrCircuitOpen
+	}
+
+	pipe := cd.opt.Redis.Pipeline()
+	cmds := make([]*redis.Cmd, len(tags))
+	for i, tag := range tags {
+		cmds[i] = pipe.Eval(ctx, popTagScript, []string{cd.tagKey(tag)})
+	}
+	_, err := pipe.Exec(ctx)
+	cd.redisDone(err)
+	if err != nil {
+		return err
+	}
+
+	var keys []string
+	for _, cmd := range cmds {
+		members, err := cmd.StringSlice()
+		if err != nil {
+			return err
+		}
+		keys = append(keys, members...)
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+
+	return cd.deleteMulti(ctx, keys...)
+}
@@ -0,0 +1,148 @@
+package cache_test
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/go-redis/cache/v9"
+)
+
+var _ = Describe("Tags", func() {
+	ctx := context.TODO()
+
+	var rdb *redis.Ring
+	var mycache *cache.Cache
+
+	newBusCache := func() *cache.Cache {
+		return cache.New(&cache.Options{
+			Redis:               rdb,
+			LocalCache:          cache.NewTinyLFU(1000, time.Minute),
+			InvalidationChannel: "cache-invalidation",
+		})
+	}
+
+	BeforeEach(func() {
+		rdb = newRing()
+		mycache = newBusCache()
+
+		err := mycache.Set(&cache.Item{
+			Ctx:   ctx,
+			Key:   "user:1",
+			Value: "profile",
+			TTL:   time.Hour,
+			Tags:  []string{"user:1"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		err = mycache.SetMulti([]*cache.Item{
+			{Ctx: ctx, Key: "feed:1", Value: "feed", TTL: 2 * time.Hour, Tags: []string{"user:1", "feeds"}},
+			{Ctx: ctx, Key: "feed:2", Value: "feed", TTL: time.Hour, Tags: []string{"user:2", "feeds"}},
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(mycache.Close()).NotTo(HaveOccurred())
+	})
+
+	It("invalidates tagged keys", func() {
+		err := mycache.InvalidateTags(ctx, "user:1")
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(mycache.Exists(ctx, "user:1")).To(BeFalse())
+		Expect(mycache.Exists(ctx, "feed:1")).To(BeFalse())
+		Expect(mycache.Exists(ctx, "feed:2")).To(BeTrue())
+
+		n, err := rdb.Exists(ctx, "cache:tag:user:1").Result()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n).To(Equal(int64(0)))
+	})
+
+	It("invalidates multiple tags", func() {
+		err := mycache.InvalidateTags(ctx, "feeds", "unknown")
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(mycache.Exists(ctx, "user:1")).To(BeTrue())
+		Expect(mycache.Exists(ctx, "feed:1")).To(BeFalse())
+		Expect(mycache.Exists(ctx, "feed:2")).To(BeFalse())
+	})
+
+	It("invalidates the LocalCache of other processes", func() {
+		other := newBusCache()
+		defer other.Close()
+		Expect(other.Exists(ctx, "user:1")).To(BeTrue())
+
+		err := mycache.InvalidateTags(ctx, "user:1")
+		Expect(err).NotTo(HaveOccurred())
+
+		Eventually(func() bool {
+			return other.Exists(ctx, "user:1")
+		}).Should(BeFalse())
+	})
+
+	It("expires tags with the longest-lived key", func() {
+		ttl, err := rdb.TTL(ctx, "cache:tag:user:1").Result()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ttl).To(Equal(2 * time.Hour))
+
+		ttl, err = rdb.TTL(ctx, "cache:tag:user:2").Result()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ttl).To(Equal(time.Hour))
+	})
+
+	It("does not share tags between prefixes", func() {
+		other := cache.New(&cache.Options{
+			Redis:  rdb,
+			Prefix: "other:",
+		})
+		err := other.Set(&cache.Item{
+			Ctx:   ctx,
+			Key:   "user:1",
+			Value: "profile",
+			Tags:  []string{"user:1"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		err = other.InvalidateTags(ctx, "user:1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(other.Exists(ctx, "user:1")).To(BeFalse())
+		Expect(mycache.Exists(ctx, "user:1")).To(BeTrue())
+
+		n, err := rdb.Exists(ctx, "cache:tag:user:1").Result()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n).To(Equal(int64(1)))
+	})
+
+	It("requires Redis", func() {
+		mycache := cache.New(&cache.Options{
+			LocalCache: cache.NewTinyLFU(1000, time.Minute),
+		})
+		err := mycache.InvalidateTags(ctx, "user:1")
+		Expect(err).To(MatchError("cache: tags require Redis"))
+	})
+
+	It("requires InvalidationChannel or Tracking with LocalCache", func() {
+		mycache := newCacheWithLocal(rdb)
+
+		err := mycache.Set(&cache.Item{
+			Ctx:   ctx,
+			Key:   "user:1",
+			Value: "profile",
+			Tags:  []string{"user:1"},
+		})
+		Expect(err).To(MatchError("cache: tags with LocalCache require InvalidationChannel or Tracking"))
+
+		err = mycache.SetMulti([]*cache.Item{{Ctx: ctx, Key: "user:1", Tags: []string{"user:1"}}})
+		Expect(err).To(MatchError("cache: tags with LocalCache require InvalidationChannel or Tracking"))
+
+		err = mycache.InvalidateTags(ctx, "user:1")
+		Expect(err).To(MatchError("cache: tags with LocalCache require InvalidationChannel or Tracking"))
+
+		err = newCache(rdb).InvalidateTags(ctx, "user:1")
+		Expect(err).NotTo(HaveOccurred())
+	})
+})
@@ -0,0 +1,263 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const invalidateChannel = "__redis__:invalidate"
+
+// TrackingOptions configures server-assisted client-side caching using
+// CLIENT TRACKING, which requires Redis 6.0 or later. The server notifies
+// the cache when keys stored in the LocalCache are modified, so local
+// entries can live much longer than with a fixed TTL alone.
+//
+// Invalidations are received on a dedicated connection subscribed to
+// __redis__:invalidate. While that connection is down, the LocalCache is
+// flushed and not populated.
+type TrackingOptions struct {
+	// Redis is used to open the dedicated tracking connections.
+	// It must point to the same server as Options.Redis.
+	Redis *redis.Options
+
+	// Broadcast enables broadcast mode, in which the server sends
+	// invalidations for all keys matching Prefixes. By default,
+	// the server only tracks the keys read by the cache, so the cache
+	// reads keys through a dedicated client and does not store the values
+	// it writes in the LocalCache.
+	Broadcast bool
+
+	// Prefixes limits broadcast mode to the keys with the given prefixes.
+	// By default, all keys are tracked.
+	Prefixes []string
+}
+
+// tracker evicts keys from the LocalCache when the server reports that
+// they were modified.
+type tracker struct {
+	// subscriberID must stay the first field, so it is 64-bit aligned
+	// for the atomic operations on 32-bit platforms.
+	subscriberID int64
+
+	cd  *Cache
+	opt *TrackingOptions
+
+	subscriber *redis.Client
+	pubsub     *redis.PubSub
+
+	connected int32
+
+	mu   sync.RWMutex
+	data *redis.Client
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func newTracker(cd *Cache, opt *TrackingOptions) *tracker {
+	if opt.Redis == nil {
+		panic("cache: TrackingOptions.Redis is required")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t := &tracker{
+		cd:     cd,
+		opt:    opt,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+
+	t.subscriber = redis.NewClient(t.clientOptions(t.initSubscriber))
+	t.pubsub = t.subscriber.Subscribe(ctx, invalidateChannel)
+	go t.listen(ctx)
+
+	return t
+}
+
+// clientOptions returns the options for a dedicated tracking client. RESP2 is
+// used, because go-redis does not support RESP3 push messages, and with RESP2
+// the server sends invalidations as Pub/Sub messages.
+func (t *tracker) clientOptions(
+	onConnect func(ctx context.Context, cn *redis.Conn) error,
+) *redis.Options {
+	opt := *t.opt.Redis
+	opt.Protocol = 2
+
+	userOnConnect := opt.OnConnect
+	opt.OnConnect = func(ctx context.Context, cn *redis.Conn) error {
+		if userOnConnect != nil {
+			if err := userOnConnect(ctx, cn); err != nil {
+				return err
+			}
+		}
+		return onConnect(ctx, cn)
+	}
+
+	return &opt
+}
+
+// initSubscriber records the id of the subscriber connection before it
+// subscribes. In broadcast mode, the subscriber also enables tracking
+// redirecting the invalidations to itself, so tracking lasts as long as
+// the subscription.
+func (t *tracker) initSubscriber(ctx context.Context, cn *redis.Conn) error {
+	id, err := cn.ClientID(ctx).Result()
+	if err != nil {
+		return err
+	}
+	atomic.StoreInt64(&t.subscriberID, id)
+
+	if !t.opt.Broadcast {
+		return nil
+	}
+
+	args := []interface{}{"client", "tracking", "on", "redirect", id, "bcast"}
+	for _, prefix := range t.opt.Prefixes {
+		args = append(args, "prefix", prefix)
+	}
+	return cn.Process(ctx, redis.NewStatusCmd(ctx, args...))
+}
+
+func (t *tracker) newDataClient(subscriberID int64) *redis.Client {
+	return redis.NewClient(t.clientOptions(func(ctx context.Context, cn *redis.Conn) error {
+		cmd := redis.NewStatusCmd(ctx, "client", "tracking", "on", "redirect", subscriberID)
+		return cn.Process(ctx, cmd)
+	}))
+}
+
+func (t *tracker) listen(ctx context.Context) {
+	defer close(t.done)
+
+	receive(ctx, t.pubsub, subscriptionHandler{
+		subscribed: t.subscribed,
+		failed:     t.failed,
+		message:    t.handle,
+	})
+}
+
+func (t *tracker) subscribed() {
+	t.cd.resetLocalCache()
+
+	if !t.opt.Broadcast {
+		// The connections of the previous data client redirect
+		// invalidations to the old subscriber, which is gone.
+		t.swapData(t.newDataClient(atomic.LoadInt64(&t.subscriberID)))
+	}
+
+	atomic.StoreInt32(&t.connected, 1)
+}
+
+func (t *tracker) failed() {
+	atomic.StoreInt32(&t.connected, 0)
+
+	if !t.opt.Broadcast {
+		t.swapData(nil)
+	}
+
+	t.cd.resetLocalCache()
+}
+
+func (t *tracker) handle(msg *redis.Message) {
+	if msg.Channel != invalidateChannel {
+		return
+	}
+	t.cd.evictLocal(msg.PayloadSlice)
+}
+
+func (t *tracker) swapData(data *redis.Client) {
+	t.mu.Lock()
+	old := t.data
+	t.data = data
+	t.mu.Unlock()
+
+	if old != nil {
+		_ = old.Close()
+	}
+}
+
+func (t *tracker) isConnected() bool {
+	return atomic.LoadInt32(&t.connected) == 1
+}
+
+// reader returns the client to read keys from and reports whether
+// the values read can be stored in the LocalCache.
+func (t *tracker) reader(rdb rediser) (rediser, bool) {
+	if t == nil {
+		return rdb, true
+	}
+	if t.opt.Broadcast {
+		return rdb, t.isConnected()
+	}
+
+	t.mu.RLock()
+	data := t.data
+	t.mu.RUnlock()
+
+	if data == nil {
+		return rdb, false
+	}
+	return data, true
+}
+
+// cachesWrites reports whether the written values can be stored in
+// the LocalCache. In default mode the server does not track the keys
+// that were not read through the data client.
+func (t *tracker) cachesWrites() bool {
+	return t == nil || (t.opt.Broadcast && t.isConnected())
+}
+
+func (t *tracker) close() error {
+	t.cancel()
+	err := t.pubsub.Close()
+	<-t.done
+
+	t.swapData(nil)
+	if err2 := t.subscriber.Close(); err == nil {
+		err = err2
+	}
+	return err
+}
+
+// setLocal stores the value written by the cache in the LocalCache or,
+// if tracking can't invalidate it later, evicts the previous value.
+func (cd *Cache) setLocal(key string, b []byte, ttl time.Duration) {
+	if cd.tracker.cachesWrites() {
+		setLocalWithTTL(cd.opt.LocalCache, key, b, ttl)
+	} else {
+		cd.opt.LocalCache.Del(key)
+	}
+}
+
+// localEpoch returns the number of invalidations received so far. It is read
+// before a value is fetched from Redis and passed to setLocalRead.
+func (cd *Cache) localEpoch() uint64 {
+	return atomic.LoadUint64(&cd.invalidations)
+}
+
+// setLocalRead stores the value read from Redis in the LocalCache unless
+// an invalidation was received since epoch, because it may have been for
+// this key and arrived before the value was stored. The epoch is checked
+// again after the value is stored, since the invalidation can also arrive
+// in between.
+func (cd *Cache) setLocalRead(key string, b []byte, ttl time.Duration, epoch uint64) {
+	if cd.localEpoch() != epoch {
+		return
+	}
+	setLocalWithTTL(cd.opt.LocalCache, key, b, ttl)
+	if cd.localEpoch() != epoch {
+		cd.opt.LocalCache.Del(key)
+	}
+}
+
+// evictLocal evicts the keys reported by tracking or the invalidation bus
+// from the LocalCache.
+func (cd *Cache) evictLocal(keys []string) {
+	atomic.AddUint64(&cd.invalidations, 1)
+	for _, key := range keys {
+		cd.opt.LocalCache.Del(key)
+	}
+}
@@ -0,0 +1,117 @@
+package cache_test
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/go-redis/cache/v9"
+)
+
+var _ = Describe("Tracking", func() {
+	ctx := context.TODO()
+
+	const key = "mykey"
+
+	var rdb *redis.Client
+	var mycache *cache.Cache
+
+	BeforeEach(func() {
+		rdb = redis.NewClient(&redis.Options{Addr: ":6379"})
+		_ = rdb.FlushDB(ctx).Err()
+	})
+
+	AfterEach(func() {
+		Expect(mycache.Close()).NotTo(HaveOccurred())
+		Expect(rdb.Close()).NotTo(HaveOccurred())
+	})
+
+	for _, broadcast := range []bool{false, true} {
+		broadcast := broadcast
+
+		name := "does not use LocalCache until tracking is established"
+		if broadcast {
+			name += " in broadcast mode"
+		}
+
+		It(name, func() {
+			mycache = cache.New(&cache.Options{
+				Redis:      rdb,
+				LocalCache: cache.NewTinyLFU(1000, time.Minute),
+				Tracking: &cache.TrackingOptions{
+					// Tracking can't be established with an unreachable server.
+					Redis:     &redis.Options{Addr: ":1", MaxRetries: -1},
+					Broadcast: broadcast,
+				},
+			})
+
+			err := mycache.Set(&cache.Item{Ctx: ctx, Key: key, Value: "v1"})
+			Expect(err).NotTo(HaveOccurred())
+
+			var s string
+			Expect(mycache.Get(ctx, key, &s)).NotTo(HaveOccurred())
+			Expect(s).To(Equal("v1"))
+
+			// The value is overwritten bypassing the cache, so only
+			// tracking could evict it from the LocalCache.
+			other := cache.New(&cache.Options{Redis: rdb})
+			err = other.Set(&cache.Item{Ctx: ctx, Key: key, Value: "v2"})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(mycache.Get(ctx, key, &s)).NotTo(HaveOccurred())
+			Expect(s).To(Equal("v2"))
+		})
+
+		name = "evicts values modified by other clients from LocalCache"
+		if broadcast {
+			name += " in broadcast mode"
+		}
+
+		It(name, func() {
+			if err := rdb.Do(ctx, "client", "tracking", "off").Err(); err != nil {
+				Skip("CLIENT TRACKING is not supported: " + err.Error())
+			}
+
+			local := cache.NewTinyLFU(1000, time.Minute)
+			mycache = cache.New(&cache.Options{
+				Redis:      rdb,
+				LocalCache: local,
+				Tracking: &cache.TrackingOptions{
+					Redis:     &redis.Options{Addr: rdb.Options().Addr},
+					Broadcast: broadcast,
+				},
+			})
+
+			// The value is written bypassing the cache, so only
+			// tracking could evict it from the LocalCache.
+			other := cache.New(&cache.Options{Redis: rdb})
+			err := other.Set(&cache.Item{Ctx: ctx, Key: key, Value: "v1"})
+			Expect(err).NotTo(HaveOccurred())
+
+			// Values are stored in the LocalCache once tracking is established.
+			Eventually(func() bool {
+				var s string
+				Expect(mycache.Get(ctx, key, &s)).NotTo(HaveOccurred())
+				Expect(s).To(Equal("v1"))
+
+				_, ok := local.Get(key)
+				return ok
+			}).Should(BeTrue())
+
+			err = other.Set(&cache.Item{Ctx: ctx, Key: key, Value: "v2"})
+			Expect(err).NotTo(HaveOccurred())
+
+			Eventually(func() bool {
+				_, ok := local.Get(key)
+				return ok
+			}).Should(BeFalse())
+
+			var s string
+			Expect(mycache.Get(ctx, key, &s)).NotTo(HaveOccurred())
+			Expect(s).To(Equal("v2"))
+		})
+	}
+})
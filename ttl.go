@@ -0,0 +1,145 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	errTTLRedisNil = errors.New("cache: GetWithTTL requires Redis")
+	errTouchTTL    = errors.New("cache: Touch requires a positive ttl")
+)
+
+// GetWithTTL gets the value for the given key and returns its remaining
+// TTL in Redis, e.g. to set the max-age of an HTTP response. The value is
+// read from Redis, because the LocalCache does not know the TTL, and is
+// stored in the LocalCache for no longer than the TTL. The TTL is 0 if
+// the key does not expire.
+func (cd *Cache) GetWithTTL(
+	ctx context.Context, key string, value interface{},
+) (time.Duration, error) {
+	event := &Event{Op: OpGet, Key: cd.key(ctx, key)}
+
+	var ttl time.Duration
+	err := cd.withGroupStats(key, event, func() error {
+		return cd.withHooks(ctx, event, func(ctx context.Context) error {
+			b, d, err := cd.getBytesWithTTL(ctx, event.Key, 0)
+			if err != nil {
+				return err
+			}
+			event.Tier, event.Size = TierRedis, len(b)
+			ttl = d
+
+			if isNotFound(b) {
+				return ErrNotFound
+			}
+			return cd.unmarshalValue(b, value)
+		})
+	})
+	return ttl, err
+}
+
+// getBytesWithTTL gets the value and its TTL from Redis using a pipeline.
+// The value is stored in the LocalCache for localTTL, or the LocalCache
+// default if it is zero, but no longer than the TTL.
+func (cd *Cache) getBytesWithTTL(
+	ctx context.Context, key string, localTTL time.Duration,
+) ([]byte, time.Duration, error) {
+	if cd.opt.Redis == nil {
+		return nil, 0, errTTLRedisNil
+	}
+
+	if !cd.breaker.allow() {
+		cd.incr(&cd.stats.misses, 1)
+		return nil, 0, ErrCacheMiss
+	}
+
+	epoch := cd.localEpoch()
+	rdb, cacheLocally := cd.tracker.reader(cd.opt.Redis)
+	pipe := rdb.Pipeline()
+	get := pipe.Get(ctx, key)
+	pttl := pipe.PTTL(ctx, key)
+	_, err := pipe.Exec(ctx)
+	cd.redisDone(err)
+
+	b, err := get.Bytes()
+	if err != nil {
+		cd.incr(&cd.stats.misses, 1)
+		if err == redis.Nil {
+			cd.incr(&cd.stats.redisMisses, 1)
+			return nil, 0, ErrCacheMiss
+		}
+		return nil, 0, err
+	}
+
+	ttl, err := pttl.Result()
+	if err != nil {
+		return nil, 0, err
+	}
+	if ttl < 0 {
+		// The key does not expire.
+		ttl = 0
+	}
+
+	cd.incr(&cd.stats.redisHits, 1)
+	cd.incr(&cd.stats.bytesRead, uint64(len(b)))
+
+	if ttl > 0 && (localTTL == 0 || ttl < localTTL) {
+		localTTL = ttl
+	}
+	if cd.opt.LocalCache != nil && cacheLocally {
+		cd.setLocalRead(key, b, localTTL, epoch)
+	}
+	return b, ttl, nil
+}
+
+// Touch sets the TTL of the key in Redis and the LocalCache, e.g. to extend
+// a session on access. It returns ErrCacheMiss if the key does not exist.
+// The ttl must be positive; use Delete to remove the key.
+func (cd *Cache) Touch(ctx context.Context, key string, ttl time.Duration) error {
+	if ttl <= 0 {
+		return errTouchTTL
+	}
+
+	key = cd.key(ctx, key)
+	return cd.withHooks(ctx, &Event{Op: OpTouch, Key: key}, func(ctx context.Context) error {
+		return cd.touch(ctx, key, ttl)
+	})
+}
+
+func (cd *Cache) touch(ctx context.Context, key string, ttl time.Duration) error {
+	var found bool
+	if cd.opt.LocalCache != nil {
+		var b []byte
+		if b, found = cd.opt.LocalCache.Get(key); found {
+			cd.setLocal(key, b, ttl)
+		}
+	}
+
+	if cd.opt.Redis == nil {
+		if cd.opt.LocalCache == nil {
+			return errRedisLocalCacheNil
+		}
+		if !found {
+			return ErrCacheMiss
+		}
+		return nil
+	}
+
+	if !cd.breaker.allow() {
+		return ErrCircuitOpen
+	}
+
+	ok, err := cd.opt.Redis.Expire(ctx, key, ttl).Result()
+	cd.redisDone(err)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrCacheMiss
+	}
+	return nil
+}
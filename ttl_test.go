@@ -0,0 +1,77 @@
+package cache_test
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/go-redis/cache/v9"
+)
+
+var _ = Describe("TTL", func() {
+	ctx := context.TODO()
+
+	var rdb *redis.Ring
+	var mycache *cache.Cache
+
+	BeforeEach(func() {
+		rdb = newRing()
+		mycache = newCacheWithLocal(rdb)
+
+		err := mycache.Set(&cache.Item{
+			Ctx:   ctx,
+			Key:   "key",
+			Value: "value",
+			TTL:   time.Minute,
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("gets the value with TTL", func() {
+		var s string
+		ttl, err := mycache.GetWithTTL(ctx, "key", &s)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(s).To(Equal("value"))
+		Expect(ttl).To(BeNumerically("~", time.Minute, time.Second))
+
+		_, err = mycache.GetWithTTL(ctx, "missing", &s)
+		Expect(err).To(Equal(cache.ErrCacheMiss))
+	})
+
+	It("touches the key", func() {
+		Expect(mycache.Touch(ctx, "key", time.Hour)).NotTo(HaveOccurred())
+
+		ttl, err := mycache.GetWithTTL(ctx, "key", nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ttl).To(BeNumerically("~", time.Hour, time.Second))
+
+		Expect(mycache.Touch(ctx, "missing", time.Hour)).To(Equal(cache.ErrCacheMiss))
+	})
+
+	It("requires a positive TTL in Touch", func() {
+		Expect(mycache.Touch(ctx, "key", 0)).To(MatchError("cache: Touch requires a positive ttl"))
+		Expect(mycache.Touch(ctx, "key", -time.Second)).To(MatchError("cache: Touch requires a positive ttl"))
+		Expect(mycache.Exists(ctx, "key")).To(BeTrue())
+	})
+
+	It("extends the TTL in Once with SlidingTTL", func() {
+		mycache = newCache(rdb)
+
+		var s string
+		err := mycache.Once(&cache.Item{
+			Ctx:        ctx,
+			Key:        "key",
+			Value:      &s,
+			SlidingTTL: time.Hour,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(s).To(Equal("value"))
+
+		ttl, err := rdb.PTTL(ctx, "key").Result()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ttl).To(BeNumerically("~", time.Hour, time.Second))
+	})
+})
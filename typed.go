@@ -0,0 +1,65 @@
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// TypedCache is a type-safe wrapper around Cache that stores and loads
+// values of type T.
+type TypedCache[T any] struct {
+	cache *Cache
+}
+
+// NewTyped returns a TypedCache that stores values of type T in the cache.
+func NewTyped[T any](cache *Cache) *TypedCache[T] {
+	return &TypedCache[T]{
+		cache: cache,
+	}
+}
+
+// Cache returns the underlying cache.
+func (c *TypedCache[T]) Cache() *Cache {
+	return c.cache
+}
+
+// Get gets the value for the given key.
+func (c *TypedCache[T]) Get(ctx context.Context, key string) (T, error) {
+	var value T
+	if err := c.cache.Get(ctx, key, &value); err != nil {
+		var zero T
+		return zero, err
+	}
+	return value, nil
+}
+
+// Set caches the value for the given key.
+func (c *TypedCache[T]) Set(ctx context.Context, key string, value T, ttl time.Duration) error {
+	return c.cache.Set(&Item{
+		Ctx:   ctx,
+		Key:   key,
+		Value: value,
+		TTL:   ttl,
+	})
+}
+
+// Once gets the value for the given key from the cache or executes, caches,
+// and returns the results of the given fn. See Cache.Once for details.
+func (c *TypedCache[T]) Once(
+	ctx context.Context, key string, ttl time.Duration, fn func(context.Context) (T, error),
+) (T, error) {
+	var value T
+	if err := c.cache.Once(&Item{
+		Ctx:   ctx,
+		Key:   key,
+		Value: &value,
+		TTL:   ttl,
+		Do: func(item *Item) (interface{}, error) {
+			return fn(item.Context())
+		},
+	}); err != nil {
+		var zero T
+		return zero, err
+	}
+	return value, nil
+}
@@ -0,0 +1,75 @@
+package cache_test
+
+import (
+	"context"
+	"io"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/go-redis/cache/v9"
+)
+
+var _ = Describe("TypedCache", func() {
+	ctx := context.TODO()
+
+	const key = "mykey"
+
+	var objects *cache.TypedCache[Object]
+
+	BeforeEach(func() {
+		objects = cache.NewTyped[Object](newCacheWithLocal(newRing()))
+	})
+
+	It("Gets and Sets values", func() {
+		obj := Object{Str: "mystring", Num: 42}
+		err := objects.Set(ctx, key, obj, time.Hour)
+		Expect(err).NotTo(HaveOccurred())
+
+		got, err := objects.Get(ctx, key)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(got).To(Equal(obj))
+	})
+
+	It("returns zero value on cache miss", func() {
+		got, err := objects.Get(ctx, key)
+		Expect(err).To(Equal(cache.ErrCacheMiss))
+		Expect(got).To(Equal(Object{}))
+	})
+
+	It("calls fn once", func() {
+		var callCount int64
+		perform(100, func(int) {
+			got, err := objects.Once(ctx, key, time.Hour, func(context.Context) (Object, error) {
+				atomic.AddInt64(&callCount, 1)
+				return Object{Str: "mystring", Num: 42}, nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(got).To(Equal(Object{Str: "mystring", Num: 42}))
+		})
+		Expect(callCount).To(Equal(int64(1)))
+	})
+
+	It("returns fn error", func() {
+		got, err := objects.Once(ctx, key, time.Hour, func(context.Context) (Object, error) {
+			return Object{Num: 1}, io.EOF
+		})
+		Expect(err).To(Equal(io.EOF))
+		Expect(got).To(Equal(Object{}))
+	})
+
+	It("works with pointers", func() {
+		ptrs := cache.NewTyped[*Object](objects.Cache())
+		got, err := ptrs.Once(ctx, key, time.Hour, func(context.Context) (*Object, error) {
+			return &Object{Str: "mystring", Num: 42}, nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(got).To(Equal(&Object{Str: "mystring", Num: 42}))
+
+		got, err = ptrs.Get(ctx, key)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(got).To(Equal(&Object{Str: "mystring", Num: 42}))
+	})
+})
@@ -0,0 +1,178 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"math/rand"
+	"reflect"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrUpdateConflict is returned by Update when the value keeps being
+// modified concurrently.
+var ErrUpdateConflict = errors.New("cache: too many concurrent updates")
+
+var (
+	errUpdateRedisNil = errors.New("cache: Update requires Redis")
+	errUpdateTTL      = errors.New("cache: Update requires a non-negative ttl")
+)
+
+const (
+	updateMaxRetries = 10
+	// updateMaxBackoff limits the random delay between the retries.
+	updateMaxBackoff = 100 * time.Millisecond
+)
+
+// casScript sets the key only if the SHA-1 of its current value is ARGV[1],
+// or if the key does not exist and ARGV[1] is empty.
+const casScript = `
+local cur = redis.call("get", KEYS[1])
+if cur then
+	if redis.sha1hex(cur) ~= ARGV[1] then
+		return 0
+	end
+elseif ARGV[1] ~= "" then
+	return 0
+end
+if tonumber(ARGV[3]) > 0 then
+	redis.call("set", KEYS[1], ARGV[2], "px", ARGV[3])
+else
+	redis.call("set", KEYS[1], ARGV[2])
+end
+return 1
+`
+
+// Update atomically replaces the value for the given key with the value
+// returned by fn, e.g. to increment a counter shared by several processes.
+// The current value is unmarshaled into value, which must be a pointer,
+// and passed to fn as old; old is nil if the key does not exist. value is
+// reset to its zero value before each read, so maps and structs don't keep
+// fields from a previous value.
+//
+// The new value is written only if the value in Redis was not modified
+// since it was read. Otherwise, the value is read again and fn is called
+// again after a short random delay, so fn must not have side effects.
+// After 10 conflicts Update returns ErrUpdateConflict. On success the new
+// value is also stored in the LocalCache. The ttl has the same meaning as
+// Item.TTL, except that it can't be negative, because the value is always
+// written to Redis.
+func (cd *Cache) Update(
+	ctx context.Context,
+	key string,
+	ttl time.Duration,
+	value interface{},
+	fn func(old interface{}) (interface{}, error),
+) error {
+	if cd.opt.Redis == nil {
+		return errUpdateRedisNil
+	}
+	if ttl < 0 {
+		return errUpdateTTL
+	}
+
+	item := &Item{Ctx: ctx, Key: cd.key(ctx, key), TTL: ttl}
+	event := &Event{Op: OpSet, Key: item.Key}
+	return cd.withHooks(ctx, event, func(ctx context.Context) error {
+		item.Ctx = ctx
+		for i := 0; i < updateMaxRetries; i++ {
+			if i > 0 {
+				if err := sleep(ctx, updateBackoff(i)); err != nil {
+					return err
+				}
+			}
+
+			b, updated, err := cd.update(item, value, fn)
+			if err != nil {
+				return err
+			}
+			if updated {
+				event.Size = len(b)
+				return nil
+			}
+		}
+		return ErrUpdateConflict
+	})
+}
+
+// updateBackoff returns a random delay before the retry that grows
+// exponentially with the number of conflicts.
+func updateBackoff(retry int) time.Duration {
+	max := time.Millisecond << uint(retry)
+	if max > updateMaxBackoff {
+		max = updateMaxBackoff
+	}
+	return time.Duration(rand.Int63n(int64(max)))
+}
+
+// resetValue sets the value pointed to by value to its zero value.
+func resetValue(value interface{}) {
+	if v := reflect.ValueOf(value); v.Kind() == reflect.Ptr && !v.IsNil() {
+		v.Elem().Set(reflect.Zero(v.Elem().Type()))
+	}
+}
+
+func (cd *Cache) update(
+	item *Item,
+	value interface{},
+	fn func(old interface{}) (interface{}, error),
+) ([]byte, bool, error) {
+	ctx := item.Context()
+
+	if !cd.breaker.allow() {
+		return nil, false, ErrCircuitOpen
+	}
+	b, err := cd.opt.Redis.Get(ctx, item.Key).Bytes()
+	cd.redisDone(err)
+
+	resetValue(value)
+
+	var old interface{}
+	var sum string
+	switch {
+	case err == redis.Nil:
+	case err != nil:
+		return nil, false, err
+	default:
+		h := sha1.Sum(b)
+		sum = hex.EncodeToString(h[:])
+		if !isNotFound(b) {
+			if err := cd.unmarshalValue(b, value); err != nil {
+				return nil, false, err
+			}
+			old = value
+		}
+	}
+
+	newValue, err := fn(old)
+	if err != nil {
+		return nil, false, err
+	}
+	b, err = cd.Marshal(newValue)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if !cd.breaker.allow() {
+		return nil, false, ErrCircuitOpen
+	}
+	n, err := cd.opt.Redis.Eval(ctx, casScript, []string{item.Key},
+		sum, b, item.redisTTL().Milliseconds()).Int()
+	cd.redisDone(err)
+	if err != nil {
+		return nil, false, err
+	}
+	if n == 0 {
+		return nil, false, nil
+	}
+
+	cd.incr(&cd.stats.bytesWritten, uint64(len(b)))
+	if cd.opt.LocalCache != nil {
+		cd.setLocal(item.Key, b, item.localTTL())
+	}
+	cd.publish(ctx, cd.opt.Redis, item.Key)
+	return b, true, nil
+}
@@ -0,0 +1,116 @@
+package cache_test
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/go-redis/cache/v9"
+)
+
+var _ = Describe("Update", func() {
+	ctx := context.TODO()
+
+	var rdb *redis.Ring
+	var mycache *cache.Cache
+
+	BeforeEach(func() {
+		rdb = newRing()
+		mycache = newCacheWithLocal(rdb)
+	})
+
+	increment := func(c *cache.Cache) error {
+		var n int
+		return c.Update(ctx, "counter", time.Hour, &n, func(old interface{}) (interface{}, error) {
+			if old == nil {
+				return 1, nil
+			}
+			return *old.(*int) + 1, nil
+		})
+	}
+
+	It("rejects negative TTL", func() {
+		var n int
+		err := mycache.Update(ctx, "counter", -1, &n, func(old interface{}) (interface{}, error) {
+			return 1, nil
+		})
+		Expect(err).To(MatchError("cache: Update requires a non-negative ttl"))
+		Expect(rdb.Exists(ctx, "counter").Val()).To(Equal(int64(0)))
+	})
+
+	It("does not lose concurrent updates", func() {
+		var wg sync.WaitGroup
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+
+				c := newCacheWithLocal(rdb)
+				for j := 0; j < 10; j++ {
+					Expect(increment(c)).NotTo(HaveOccurred())
+				}
+			}()
+		}
+		wg.Wait()
+
+		var n int
+		Expect(mycache.GetSkippingLocalCache(ctx, "counter", &n)).NotTo(HaveOccurred())
+		Expect(n).To(Equal(50))
+	})
+
+	It("updates the local cache", func() {
+		Expect(increment(mycache)).NotTo(HaveOccurred())
+		Expect(increment(mycache)).NotTo(HaveOccurred())
+
+		Expect(rdb.Del(ctx, "counter").Err()).NotTo(HaveOccurred())
+
+		var n int
+		Expect(mycache.Get(ctx, "counter", &n)).NotTo(HaveOccurred())
+		Expect(n).To(Equal(2))
+	})
+
+	It("gives up after too many conflicts", func() {
+		other := newCache(rdb)
+
+		var calls int
+		var n int
+		err := mycache.Update(ctx, "counter", time.Hour, &n, func(old interface{}) (interface{}, error) {
+			calls++
+			err := other.Set(&cache.Item{Ctx: ctx, Key: "counter", Value: -calls})
+			return calls, err
+		})
+		Expect(err).To(Equal(cache.ErrUpdateConflict))
+		Expect(calls).To(Equal(10))
+	})
+
+	It("does not merge the value with previous values", func() {
+		err := mycache.Set(&cache.Item{Ctx: ctx, Key: "map", Value: map[string]int{"a": 1}})
+		Expect(err).NotTo(HaveOccurred())
+
+		var olds []map[string]int
+		m := map[string]int{"stale": 1}
+		err = mycache.Update(ctx, "map", time.Hour, &m, func(old interface{}) (interface{}, error) {
+			cur := *old.(*map[string]int)
+			olds = append(olds, cur)
+			if len(olds) == 1 {
+				// Conflict with a write removing "a".
+				err := rdb.Set(ctx, "map", mustMarshal(mycache, map[string]int{"b": 2}), 0).Err()
+				return nil, err
+			}
+			return cur, nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(olds).To(Equal([]map[string]int{{"a": 1}, {"b": 2}}))
+	})
+})
+
+func mustMarshal(c *cache.Cache, value interface{}) []byte {
+	b, err := c.Marshal(value)
+	Expect(err).NotTo(HaveOccurred())
+	return b
+}